@@ -0,0 +1,164 @@
+package edgeexpr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ParsedAddress is the structured form of a variable address
+type ParsedAddress struct {
+	Area     string `json:"area"`                // Siemens: DB, M, I, Q; Modbus: coil, discrete_input, input_register, holding_register
+	DBNumber int    `json:"db_number,omitempty"` // Siemens data block number, only for area DB
+	Size     string `json:"size,omitempty"`      // Siemens access size: X (bit), B (byte), W (word), D (dword)
+	Offset   int    `json:"offset"`              // Byte offset (Siemens) or zero-based register/coil offset (Modbus)
+	Bit      int    `json:"bit"`                 // Bit index, -1 when the address is not a bit address
+}
+
+// AddressParser parses and validates an address for one connection type
+type AddressParser func(address string) (*ParsedAddress, error)
+
+var (
+	addressParsers = map[string]AddressParser{
+		"s7":      parseSiemensAddress,
+		"siemens": parseSiemensAddress,
+		"modbus":  parseModbusAddress,
+	}
+	addressParsersMu sync.RWMutex // 注册可能与 ParseAddress 并发
+)
+
+// RegisterAddressParser registers (or replaces) the address parser for a connection type.
+// It is safe to call concurrently with ParseAddress.
+func RegisterAddressParser(connType string, parser AddressParser) {
+	addressParsersMu.Lock()
+	defer addressParsersMu.Unlock()
+	addressParsers[strings.ToLower(connType)] = parser
+}
+
+// ParseAddress parses the address with the parser registered for the connection type.
+// It returns nil without error when no parser is registered for the connection type.
+func ParseAddress(connType, address string) (*ParsedAddress, error) {
+	addressParsersMu.RLock()
+	parser, ok := addressParsers[strings.ToLower(connType)]
+	addressParsersMu.RUnlock()
+	if !ok {
+		return nil, nil
+	}
+	return parser(address)
+}
+
+var (
+	siemensDBRegex   = regexp.MustCompile(`^DB(\d+)\.DB([XBWD])(\d+)(?:\.(\d+))?$`)
+	siemensAreaRegex = regexp.MustCompile(`^([MIQEA])([BWD])?(\d+)(?:\.(\d+))?$`)
+	modbusRegex      = regexp.MustCompile(`^([0134])(\d{4,5})(?:\.(\d+))?$`)
+)
+
+// parseSiemensAddress parses addresses like DB1.DBX0.0, DB1.DBW2, M0.1, MW10, I0.0, QB1
+func parseSiemensAddress(address string) (*ParsedAddress, error) {
+	addr := strings.ToUpper(strings.TrimSpace(address))
+	result := &ParsedAddress{Bit: -1}
+	var bitStr string
+
+	if match := siemensDBRegex.FindStringSubmatch(addr); match != nil {
+		result.Area = "DB"
+		result.DBNumber, _ = strconv.Atoi(match[1])
+		result.Size = match[2]
+		result.Offset, _ = strconv.Atoi(match[3])
+		bitStr = match[4]
+	} else if match := siemensAreaRegex.FindStringSubmatch(addr); match != nil {
+		// 德语助记符 E/A 对应 I/Q
+		switch match[1] {
+		case "E":
+			result.Area = "I"
+		case "A":
+			result.Area = "Q"
+		default:
+			result.Area = match[1]
+		}
+		result.Size = match[2]
+		if result.Size == "" {
+			result.Size = "X"
+		}
+		result.Offset, _ = strconv.Atoi(match[3])
+		bitStr = match[4]
+	} else {
+		return nil, fmt.Errorf("invalid siemens address: %q", address)
+	}
+
+	if result.Size == "X" {
+		if bitStr == "" {
+			return nil, fmt.Errorf("invalid siemens address: %q, bit index required", address)
+		}
+		result.Bit, _ = strconv.Atoi(bitStr)
+		if result.Bit > 7 {
+			return nil, fmt.Errorf("invalid siemens address: %q, bit index out of range (must be 0-7)", address)
+		}
+	} else if bitStr != "" {
+		return nil, fmt.Errorf("invalid siemens address: %q, bit index only allowed for bit access", address)
+	}
+	return result, nil
+}
+
+// S7 protocol area codes returned by ParseSiemensAddress
+const (
+	SiemensAreaI  = 0x81 // process inputs
+	SiemensAreaQ  = 0x82 // process outputs
+	SiemensAreaM  = 0x83 // merkers
+	SiemensAreaDB = 0x84 // data blocks
+)
+
+var siemensAreaCodes = map[string]int{
+	"I":  SiemensAreaI,
+	"Q":  SiemensAreaQ,
+	"M":  SiemensAreaM,
+	"DB": SiemensAreaDB,
+}
+
+// ParseSiemensAddress splits a Siemens address like DB1.DBX1.3, DB1.DBB2, DB1.DBW4 or DB1.DBD8 into the S7
+// area code, data block number, byte offset and bit offset. bitOffset is -1 for byte, word and dword access.
+func ParseSiemensAddress(addr string) (area, dbNumber, byteOffset, bitOffset int, err error) {
+	parsed, err := parseSiemensAddress(addr)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	return siemensAreaCodes[parsed.Area], parsed.DBNumber, parsed.Offset, parsed.Bit, nil
+}
+
+// parseModbusAddress parses 5 or 6 digit Modbus addresses like 40001, 300010 or 40001.3
+func parseModbusAddress(address string) (*ParsedAddress, error) {
+	match := modbusRegex.FindStringSubmatch(strings.TrimSpace(address))
+	if match == nil {
+		return nil, fmt.Errorf("invalid modbus address: %q", address)
+	}
+
+	result := &ParsedAddress{Bit: -1}
+	switch match[1] {
+	case "0":
+		result.Area = "coil"
+	case "1":
+		result.Area = "discrete_input"
+	case "3":
+		result.Area = "input_register"
+	case "4":
+		result.Area = "holding_register"
+	}
+
+	number, _ := strconv.Atoi(match[2])
+	if number == 0 {
+		return nil, fmt.Errorf("invalid modbus address: %q, register numbers start at 1", address)
+	}
+	result.Offset = number - 1
+
+	if match[3] != "" {
+		if result.Area == "coil" || result.Area == "discrete_input" {
+			return nil, fmt.Errorf("invalid modbus address: %q, bit index only allowed for registers", address)
+		}
+		result.Bit, _ = strconv.Atoi(match[3])
+		if result.Bit > 15 {
+			return nil, fmt.Errorf("invalid modbus address: %q, bit index out of range (must be 0-15)", address)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,93 @@
+package edgeexpr
+
+import "testing"
+
+func TestParseAddress(t *testing.T) {
+	t.Run("SiemensDB", func(t *testing.T) {
+		addr, err := ParseAddress("s7", "DB1.DBX4.3")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if addr.Area != "DB" || addr.DBNumber != 1 || addr.Size != "X" || addr.Offset != 4 || addr.Bit != 3 {
+			t.Errorf("Unexpected parse result: %+v", addr)
+		}
+
+		addr, err = ParseAddress("s7", "DB10.DBD20")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if addr.DBNumber != 10 || addr.Size != "D" || addr.Offset != 20 || addr.Bit != -1 {
+			t.Errorf("Unexpected parse result: %+v", addr)
+		}
+	})
+
+	t.Run("ModbusRegister", func(t *testing.T) {
+		addr, err := ParseAddress("modbus", "40001")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if addr.Area != "holding_register" || addr.Offset != 0 || addr.Bit != -1 {
+			t.Errorf("Unexpected parse result: %+v", addr)
+		}
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		for _, c := range []struct{ connType, address string }{
+			{"s7", "DB1.DBX4"},
+			{"s7", "DB1.DBW4.1"},
+			{"s7", "XYZ"},
+			{"modbus", "50001"},
+			{"modbus", "40000"},
+		} {
+			if _, err := ParseAddress(c.connType, c.address); err == nil {
+				t.Errorf("Expected error for %s address %q", c.connType, c.address)
+			}
+		}
+	})
+
+	t.Run("UnknownConnectionType", func(t *testing.T) {
+		addr, err := ParseAddress("opcua", "ns=2;s=Tag")
+		if err != nil || addr != nil {
+			t.Errorf("Expected no parser for unknown connection type, got %+v, %v", addr, err)
+		}
+	})
+
+	t.Run("VariableValidate", func(t *testing.T) {
+		v := &Variable{Key: "temp", Connection: "plc1", Address: "DB1.DBD0", DataTypeStr: "Float32"}
+		if err := v.Validate("s7"); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		v.Address = "DB1.DBD"
+		if err := v.Validate("s7"); err == nil {
+			t.Error("Expected error for malformed address")
+		}
+	})
+}
+
+func TestParseSiemensAddress(t *testing.T) {
+	tests := []struct {
+		address                               string
+		area, dbNumber, byteOffset, bitOffset int
+	}{
+		{"DB1.DBX1.3", SiemensAreaDB, 1, 1, 3},
+		{"DB2.DBB2", SiemensAreaDB, 2, 2, -1},
+		{"DB3.DBW4", SiemensAreaDB, 3, 4, -1},
+		{"DB10.DBD8", SiemensAreaDB, 10, 8, -1},
+		{"M0.1", SiemensAreaM, 0, 0, 1},
+	}
+	for _, tt := range tests {
+		area, dbNumber, byteOffset, bitOffset, err := ParseSiemensAddress(tt.address)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.address, err)
+			continue
+		}
+		if area != tt.area || dbNumber != tt.dbNumber || byteOffset != tt.byteOffset || bitOffset != tt.bitOffset {
+			t.Errorf("%s: expected (%#x, %d, %d, %d), got (%#x, %d, %d, %d)", tt.address,
+				tt.area, tt.dbNumber, tt.byteOffset, tt.bitOffset, area, dbNumber, byteOffset, bitOffset)
+		}
+	}
+
+	if _, _, _, _, err := ParseSiemensAddress("DB1.DBX1.8"); err == nil {
+		t.Error("Expected error for malformed address")
+	}
+}
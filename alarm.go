@@ -0,0 +1,84 @@
+package edgeexpr
+
+import (
+	"fmt"
+	"time"
+)
+
+// AlarmType is the kind of limit checked by an AlarmDef
+type AlarmType string
+
+const (
+	AlarmHi   AlarmType = "hi"   // value above Limit
+	AlarmHiHi AlarmType = "hihi" // value above Limit, usually a higher limit than hi
+	AlarmLo   AlarmType = "lo"   // value below Limit
+	AlarmLoLo AlarmType = "lolo" // value below Limit, usually a lower limit than lo
+)
+
+func AlarmTypeValidator(t AlarmType) error {
+	switch t {
+	case AlarmHi, AlarmHiHi, AlarmLo, AlarmLoLo:
+		return nil
+	default:
+		return fmt.Errorf("invalid alarm type: %q", t)
+	}
+}
+
+// AlarmDef is a limit alarm on a numeric variable, checked against the scaled value in WriteValue
+type AlarmDef struct {
+	Type    AlarmType `json:"type"`
+	Limit   float64   `json:"limit"`
+	Message string    `json:"message,omitempty"` // Optional message for the event
+	Level   int       `json:"level,omitempty"`   // Optional level for the event, e.g., 1 for critical, 2 for warning, etc.
+}
+
+// exceeded reports whether value violates the limit
+func (a *AlarmDef) exceeded(value float64) bool {
+	switch a.Type {
+	case AlarmHi, AlarmHiHi:
+		return value > a.Limit
+	case AlarmLo, AlarmLoLo:
+		return value < a.Limit
+	default:
+		return false
+	}
+}
+
+// checkAlarms records an event for every alarm that becomes active with value.
+// An alarm fires once per crossing and re-arms when the value returns within the limit.
+func (v *Variable) checkAlarms(value float64, t *time.Time) {
+	if len(v.Alarms) == 0 {
+		return
+	}
+	if len(v.alarmActive) != len(v.Alarms) {
+		v.alarmActive = make([]bool, len(v.Alarms))
+	}
+	for i := range v.Alarms {
+		alarm := &v.Alarms[i]
+		active := alarm.exceeded(value)
+		// 上升沿触发
+		if active && !v.alarmActive[i] {
+			ts := t
+			if ts == nil {
+				now := time.Now()
+				ts = &now
+			}
+			v.events = append(v.events, TriggeredEvent{
+				Key:       fmt.Sprintf("%s.%s", v.Key, alarm.Type),
+				Category:  "alarm",
+				Level:     alarm.Level,
+				Message:   alarm.Message,
+				Value:     value,
+				Timestamp: ts,
+			})
+		}
+		v.alarmActive[i] = active
+	}
+}
+
+// DrainEvents returns the alarm events raised since the last call and clears them
+func (v *Variable) DrainEvents() []TriggeredEvent {
+	events := v.events
+	v.events = nil
+	return events
+}
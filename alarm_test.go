@@ -0,0 +1,66 @@
+package edgeexpr
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestVariable_Alarms(t *testing.T) {
+	jsonStr := `{
+		"key": "temp",
+		"connection": "plc1",
+		"address": "DB1.DBD0",
+		"data_type": "Float32",
+		"alarms": [
+			{"type": "hi", "limit": 80, "message": "Temperature high", "level": 2},
+			{"type": "hihi", "limit": 100, "message": "Temperature very high", "level": 1}
+		]
+	}`
+	var v Variable
+	if err := json.Unmarshal([]byte(jsonStr), &v); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+
+	for _, value := range []float64{70, 85, 90, 95} {
+		v.WriteValue(value, nil)
+	}
+	// 一次越限只产生一个事件
+	events := v.DrainEvents()
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event for a single hi crossing, got %d", len(events))
+	}
+	if events[0].Key != "temp.hi" || events[0].Level != 2 || events[0].Message != "Temperature high" || events[0].Value != 85.0 {
+		t.Errorf("Unexpected event: %+v", events[0])
+	}
+	if len(v.DrainEvents()) != 0 {
+		t.Error("Expected events to be cleared after draining")
+	}
+
+	// 回到限值以内后重新越限会再次触发
+	v.WriteValue(75, nil)
+	v.WriteValue(105, nil)
+	events = v.DrainEvents()
+	if len(events) != 2 {
+		t.Fatalf("Expected hi and hihi events, got %d", len(events))
+	}
+	if events[0].Key != "temp.hi" || events[1].Key != "temp.hihi" {
+		t.Errorf("Unexpected events: %+v", events)
+	}
+
+	data, err := json.Marshal(&v)
+	if err != nil {
+		t.Fatalf("Failed to marshal variable: %v", err)
+	}
+	var restored Variable
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+	if len(restored.Alarms) != 2 || restored.Alarms[1].Type != AlarmHiHi {
+		t.Errorf("Expected alarms to round-trip, got %+v", restored.Alarms)
+	}
+
+	var invalid Variable
+	if err := json.Unmarshal([]byte(`{"key": "x", "connection": "plc1", "data_type": "Float32", "alarms": [{"type": "high", "limit": 1}]}`), &invalid); err == nil {
+		t.Error("Expected error for invalid alarm type")
+	}
+}
@@ -1,9 +1,16 @@
 package edgeexpr
 
 import (
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -13,16 +20,27 @@ type Point[T float64 | bool | string | []byte] struct {
 	Timestamp *time.Time
 }
 
+// DefaultEpsilon is the float tolerance given to new caches, 0 means exact comparison
+var DefaultEpsilon = 0.0
+
 type Cache[T float64 | bool | string | []byte] struct {
-	Points         []Point[T]
-	ExpireDuration time.Duration
-	mu             sync.RWMutex // 读写锁保护Points切片
+	Points           []Point[T]
+	ExpireDuration   time.Duration
+	Epsilon          float64      // float64 值差的绝对值不超过 Epsilon 时视为相等，用于 Changed 和 Count
+	SkipNonFinite    bool         // 统计方法跳过 NaN/Inf，未设置时遇到 NaN/Inf 返回错误
+	LazyExpiration   bool         // 仅在最旧的点过期时才清理，并原地重用切片；开启后 Points 只能通过 AddPoint 修改
+	Compress         bool         // 与最新值相同的点不追加，只延长最新点所在的区间，最新点保留区间起始时间戳；按点数计算的统计（MA 等）每个区间只计一次
+	RejectOutOfOrder bool         // 丢弃时间戳早于最新点的数据，保证 Points 按时间排序；默认允许任意位置插入
+	mu               sync.RWMutex // 读写锁保护Points切片
+	oldest           time.Time    // LazyExpiration 模式下最早的过期基准时间（压缩区间按结束时间），零值表示未知
+	runEnd           *time.Time   // Compress 模式下最新点区间内最后一次写入的时间戳，没有重复值时为 nil
 }
 
 func NewCache[T float64 | bool | string | []byte](expireDuration time.Duration) *Cache[T] {
 	return &Cache[T]{
 		Points:         make([]Point[T], 0),
 		ExpireDuration: expireDuration,
+		Epsilon:        DefaultEpsilon,
 	}
 }
 
@@ -33,11 +51,7 @@ func (c *Cache[T]) PushValue() *PushValue {
 	if len(c.Points) == 0 {
 		return nil
 	}
-	return &PushValue{
-		// Key:       key,
-		Value:     c.Points[len(c.Points)-1].Value,
-		Timestamp: c.Points[len(c.Points)-1].Timestamp,
-	}
+	return NewPushValue("", c.Points[len(c.Points)-1])
 }
 
 func (c *Cache[T]) Value() T {
@@ -62,7 +76,30 @@ func (c *Cache[T]) Latest() T {
 	return c.Points[len(c.Points)-1].Value
 }
 
-// Timestamp returns the timestamp of the latest value
+// Previous returns the second-to-last value and whether it exists
+func (c *Cache[T]) Previous() (T, bool) {
+	return c.PreviousN(1)
+}
+
+// PreviousN returns the value n samples before the latest and whether it exists
+// PreviousN(0) is the latest value, PreviousN(1) the one before it
+func (c *Cache[T]) PreviousN(n int) (T, bool) {
+	var zeroValue T
+	if c == nil || n < 0 {
+		return zeroValue, false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if n >= len(c.Points) {
+		return zeroValue, false
+	}
+	return c.Points[len(c.Points)-1-n].Value, true
+}
+
+// Timestamp returns the timestamp of the latest value. With Compress it is the time the value was last written,
+// while the stored point keeps the time the value was first seen.
 func (c *Cache[T]) Timestamp() *time.Time {
 	if c == nil {
 		return nil
@@ -71,9 +108,16 @@ func (c *Cache[T]) Timestamp() *time.Time {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
+	return c.latestTimestampUnsafe()
+}
+
+func (c *Cache[T]) latestTimestampUnsafe() *time.Time {
 	if len(c.Points) == 0 {
 		return nil
 	}
+	if c.runEnd != nil {
+		return c.runEnd
+	}
 	return c.Points[len(c.Points)-1].Timestamp
 }
 
@@ -94,6 +138,24 @@ func (c *Cache[T]) Point() *Point[T] {
 	return &latest
 }
 
+// lastPointWhere returns a copy of the newest point whose value satisfies pred
+func (c *Cache[T]) lastPointWhere(pred func(T) bool) *Point[T] {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for i := len(c.Points) - 1; i >= 0; i-- {
+		if pred(c.Points[i].Value) {
+			point := c.Points[i]
+			return &point
+		}
+	}
+	return nil
+}
+
 // Len returns the number of points in the cache
 func (c *Cache[T]) Len() int {
 	if c == nil {
@@ -106,56 +168,230 @@ func (c *Cache[T]) Len() int {
 	return len(c.Points)
 }
 
-// MA calculates Moving Average within the specified time window
-func (c *Cache[T]) MA(window string) (float64, error) {
+// LastN returns a copy of up to the last n points in chronological order
+func (c *Cache[T]) LastN(n int) []Point[T] {
+	if c == nil || n <= 0 {
+		return []Point[T]{}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if n > len(c.Points) {
+		n = len(c.Points)
+	}
+	result := make([]Point[T], n)
+	copy(result, c.Points[len(c.Points)-n:])
+	return result
+}
+
+// AtIndex returns the point at index i, counting from the oldest for i >= 0
+// and from the newest for i < 0 (-1 is the latest); false when out of range
+func (c *Cache[T]) AtIndex(i int) (Point[T], bool) {
 	if c == nil {
-		return 0, fmt.Errorf("cache is nil")
+		return Point[T]{}, false
 	}
-	points := c.getPointsInWindow(window)
-	if len(points) == 0 {
-		return 0, fmt.Errorf("no data yet")
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if i < 0 {
+		i += len(c.Points)
+	}
+	if i < 0 || i >= len(c.Points) {
+		return Point[T]{}, false
+	}
+	return c.Points[i], true
+}
+
+// ValueAt returns the value in effect at t, i.e. of the newest point at or before t
+func (c *Cache[T]) ValueAt(t time.Time) (T, bool) {
+	var zero T
+	if c == nil {
+		return zero, false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	found := false
+	var best Point[T]
+	for _, point := range c.Points {
+		if point.Timestamp == nil || point.Timestamp.After(t) {
+			continue
+		}
+		if !found || !point.Timestamp.Before(*best.Timestamp) {
+			best = point
+			found = true
+		}
+	}
+	return best.Value, found
+}
+
+// Nearest returns the point whose timestamp is closest to t, before or after it. Points are scanned
+// linearly since out-of-order writes are accepted unless RejectOutOfOrder is set. On a tie the earlier point wins.
+func (c *Cache[T]) Nearest(t time.Time) (T, *time.Time, bool) {
+	var zero T
+	if c == nil {
+		return zero, nil, false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	found := false
+	var best Point[T]
+	var bestGap time.Duration
+	for _, point := range c.Points {
+		if point.Timestamp == nil {
+			continue
+		}
+		gap := point.Timestamp.Sub(t)
+		if gap < 0 {
+			gap = -gap
+		}
+		if !found || gap < bestGap || (gap == bestGap && point.Timestamp.Before(*best.Timestamp)) {
+			best, bestGap, found = point, gap, true
+		}
+	}
+	if !found {
+		return zero, nil, false
+	}
+	return best.Value, best.Timestamp, true
+}
+
+// IsStale checks if the latest point is older than maxAge, or the cache has no points
+func (c *Cache[T]) IsStale(maxAge string) (bool, error) {
+	duration, err := time.ParseDuration(maxAge)
+	if err != nil {
+		return false, errors.New("invalid time window format")
+	}
+	return c.staleFor(duration), nil
+}
+
+// staleFor reports whether the latest point is older than maxAge, or the cache has no points
+func (c *Cache[T]) staleFor(maxAge time.Duration) bool {
+	if c == nil {
+		return true
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	latest := c.latestTimestampUnsafe()
+	if latest == nil {
+		return true
+	}
+	return time.Since(*latest) > maxAge
+}
+
+// MA calculates Moving Average within the specified time window. With Compress a run of identical values counts once.
+func (c *Cache[T]) MA(window string) (float64, error) {
+	values, err := c.floatValuesInWindow(window)
+	if err != nil {
+		return 0, err
 	}
 
-	// 使用类型断言检查是否为 float64
 	var sum float64
-	for _, point := range points {
-		if val, ok := any(point.Value).(float64); ok {
+	for _, val := range values {
+		sum += val
+	}
+	mean := sum / float64(len(values))
+	return mean, nil
+}
+
+// TWA calculates Time-Weighted Average within the specified time window
+// Each value is weighted by the time until the next point, the latest value until now
+func (c *Cache[T]) TWA(window string) (float64, error) {
+	points, err := c.floatPointsInWindow(window)
+	if err != nil {
+		return 0, err
+	}
+
+	values := make([]float64, len(points))
+	for i, point := range points {
+		values[i] = point.Value
+	}
+
+	if len(values) == 1 {
+		return values[0], nil
+	}
+
+	now := time.Now()
+	var weightedSum, totalWeight float64
+	for i := range points {
+		end := now
+		if i < len(points)-1 {
+			end = *points[i+1].Timestamp
+		}
+		// 每个点的权重为其代表的时间段长度
+		weight := end.Sub(*points[i].Timestamp).Seconds()
+		if weight < 0 {
+			weight = 0
+		}
+		weightedSum += values[i] * weight
+		totalWeight += weight
+	}
+
+	if totalWeight == 0 {
+		// 所有点时间戳相同，退化为算术平均
+		var sum float64
+		for _, val := range values {
 			sum += val
-		} else {
-			return 0, errors.New("value is not a float64 type")
 		}
+		return sum / float64(len(values)), nil
 	}
-	mean := sum / float64(len(points))
-	return mean, nil
+	return weightedSum / totalWeight, nil
 }
 
-// StdDev calculates Standard Deviation within the specified time window
-func (c *Cache[T]) StdDev(window string) (float64, error) {
+// OnTime returns how long a bool signal was true within the specified time window. Each point counts
+// until the next point, the latest one until now.
+func (c *Cache[T]) OnTime(window string) (time.Duration, error) {
 	if c == nil {
 		return 0, fmt.Errorf("cache is nil")
 	}
+	var zero T
+	if _, ok := any(zero).(bool); !ok {
+		return 0, fmt.Errorf("value is not a bool type")
+	}
+	if _, err := parseWindow(window); err != nil {
+		return 0, errors.New("invalid time window format")
+	}
+
 	points := c.getPointsInWindow(window)
-	if len(points) == 0 {
-		return 0, fmt.Errorf("no data yet")
+	now := time.Now()
+	var onTime time.Duration
+	for i, point := range points {
+		if !any(point.Value).(bool) || point.Timestamp == nil {
+			continue
+		}
+		end := now
+		if i < len(points)-1 && points[i+1].Timestamp != nil {
+			end = *points[i+1].Timestamp
+		}
+		if d := end.Sub(*point.Timestamp); d > 0 {
+			onTime += d
+		}
+	}
+	return onTime, nil
+}
+
+// StdDev calculates Standard Deviation within the specified time window
+func (c *Cache[T]) StdDev(window string) (float64, error) {
+	values, err := c.floatValuesInWindow(window)
+	if err != nil {
+		return 0, err
 	}
 
-	if len(points) == 1 {
+	if len(values) == 1 {
 		return 0, fmt.Errorf("at least two data points are required to calculate standard deviation")
 	}
 
-	// 检查所有值是否为 float64 类型并计算平均值
+	// 计算平均值
 	var sum float64
-	var values []float64
-
-	for _, point := range points {
-		if val, ok := any(point.Value).(float64); ok {
-			sum += val
-			values = append(values, val)
-		} else {
-			return 0, errors.New("value is not a float64 type")
-		}
+	for _, val := range values {
+		sum += val
 	}
-
 	mean := sum / float64(len(values))
 
 	// 计算方差
@@ -171,6 +407,270 @@ func (c *Cache[T]) StdDev(window string) (float64, error) {
 	return standardDeviation, nil
 }
 
+// WindowStats summarizes the float64 values within a time window, see Summary
+type WindowStats struct {
+	Mean   float64 `json:"mean"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	StdDev float64 `json:"std_dev"` // population standard deviation, as StdDev
+	Sum    float64 `json:"sum"`
+	Count  int     `json:"count"` // number of values, not value changes as counted by Count
+}
+
+// Summary computes the mean, min, max, standard deviation, sum and count of the values within the
+// specified time window in a single pass. An empty window yields zeroed stats.
+// NaN and Inf values are handled as in the individual statistics methods.
+func (c *Cache[T]) Summary(window string) (WindowStats, error) {
+	var stats WindowStats
+	if c == nil {
+		return stats, fmt.Errorf("cache is nil")
+	}
+	var zero T
+	if _, ok := any(zero).(float64); !ok {
+		return stats, errors.New("value is not a float64 type")
+	}
+	if _, err := parseWindow(window); err != nil {
+		return stats, errors.New("invalid time window format")
+	}
+
+	// Welford 算法，单次遍历同时得到均值和方差
+	var m2 float64
+	for _, point := range c.getPointsInWindow(window) {
+		val := any(point.Value).(float64)
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			if c.SkipNonFinite {
+				continue
+			}
+			return WindowStats{}, errors.New("window contains NaN or Inf values")
+		}
+		stats.Count++
+		if stats.Count == 1 || val < stats.Min {
+			stats.Min = val
+		}
+		if stats.Count == 1 || val > stats.Max {
+			stats.Max = val
+		}
+		stats.Sum += val
+		delta := val - stats.Mean
+		stats.Mean += delta / float64(stats.Count)
+		m2 += delta * (val - stats.Mean)
+	}
+	if stats.Count > 0 {
+		stats.StdDev = math.Sqrt(m2 / float64(stats.Count))
+	}
+	return stats, nil
+}
+
+// Min returns the minimum value within the specified time window
+func (c *Cache[T]) Min(window string) (float64, error) {
+	values, err := c.floatValuesInWindow(window)
+	if err != nil {
+		return 0, err
+	}
+	min := values[0]
+	for _, val := range values[1:] {
+		if val < min {
+			min = val
+		}
+	}
+	return min, nil
+}
+
+// Max returns the maximum value within the specified time window
+func (c *Cache[T]) Max(window string) (float64, error) {
+	values, err := c.floatValuesInWindow(window)
+	if err != nil {
+		return 0, err
+	}
+	max := values[0]
+	for _, val := range values[1:] {
+		if val > max {
+			max = val
+		}
+	}
+	return max, nil
+}
+
+// ArgMax returns the maximum value within the specified time window and when it occurred.
+// An empty window returns 0 and a nil timestamp.
+func (c *Cache[T]) ArgMax(window string) (float64, *time.Time, error) {
+	return c.argExtremum(window, func(a, b float64) bool { return a > b })
+}
+
+// ArgMin returns the minimum value within the specified time window and when it occurred.
+// An empty window returns 0 and a nil timestamp.
+func (c *Cache[T]) ArgMin(window string) (float64, *time.Time, error) {
+	return c.argExtremum(window, func(a, b float64) bool { return a < b })
+}
+
+// argExtremum returns the earliest point whose value is not beaten by any other according to better
+func (c *Cache[T]) argExtremum(window string, better func(a, b float64) bool) (float64, *time.Time, error) {
+	var zero T
+	if _, ok := any(zero).(float64); !ok {
+		return 0, nil, errors.New("value is not a float64 type")
+	}
+	// 同一快照内判断空窗口并取值，避免两次加锁之间窗口变化
+	snapshot := c.getPointsInWindow(window)
+	if len(snapshot) == 0 {
+		return 0, nil, nil
+	}
+	points, err := c.floatPoints(snapshot)
+	if err != nil {
+		return 0, nil, err
+	}
+	best := points[0]
+	for _, point := range points[1:] {
+		if better(point.Value, best.Value) {
+			best = point
+		}
+	}
+	return best.Value, best.Timestamp, nil
+}
+
+// Sum returns the sum of values within the specified time window
+func (c *Cache[T]) Sum(window string) (float64, error) {
+	values, err := c.floatValuesInWindow(window)
+	if err != nil {
+		return 0, err
+	}
+	var sum float64
+	for _, val := range values {
+		sum += val
+	}
+	return sum, nil
+}
+
+// Median returns the median value within the specified time window
+func (c *Cache[T]) Median(window string) (float64, error) {
+	values, err := c.floatValuesInWindow(window)
+	if err != nil {
+		return 0, err
+	}
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2, nil
+	}
+	return values[mid], nil
+}
+
+// InRecentRange checks if the latest value lies within the min/max band of the earlier points in the specified time window
+// The band is widened on both sides by marginPct percent of the range (max - min)
+func (c *Cache[T]) InRecentRange(window string, marginPct float64) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("cache is nil")
+	}
+	latest := c.Point()
+	if latest == nil {
+		return true, nil
+	}
+	latestVal, ok := any(latest.Value).(float64)
+	if !ok {
+		return false, errors.New("value is not a float64 type")
+	}
+
+	min, max := math.Inf(1), math.Inf(-1)
+	found := false
+	for _, point := range c.getPointsInWindow(window) {
+		val, ok := any(point.Value).(float64)
+		if !ok {
+			return false, errors.New("value is not a float64 type")
+		}
+		// 最新点本身不参与区间计算
+		if point.Timestamp != nil && latest.Timestamp != nil && point.Timestamp.Equal(*latest.Timestamp) {
+			continue
+		}
+		min = math.Min(min, val)
+		max = math.Max(max, val)
+		found = true
+	}
+	if !found {
+		return true, nil
+	}
+
+	margin := (max - min) * marginPct / 100
+	return latestVal >= min-margin && latestVal <= max+margin, nil
+}
+
+// Aggregate dispatches to the aggregation named by fn within the specified time window
+// Supported names: "mean", "min", "max", "sum", "stddev", "median"
+func (c *Cache[T]) Aggregate(fn, window string) (float64, error) {
+	switch fn {
+	case "mean":
+		return c.MA(window)
+	case "min":
+		return c.Min(window)
+	case "max":
+		return c.Max(window)
+	case "sum":
+		return c.Sum(window)
+	case "stddev":
+		return c.StdDev(window)
+	case "median":
+		return c.Median(window)
+	default:
+		return 0, fmt.Errorf("unknown aggregation function: %s", fn)
+	}
+}
+
+// HasNonFinite checks if any value within the specified time window is NaN or Inf
+func (c *Cache[T]) HasNonFinite(window string) bool {
+	for _, point := range c.getPointsInWindow(window) {
+		if val, ok := any(point.Value).(float64); ok && (math.IsNaN(val) || math.IsInf(val, 0)) {
+			return true
+		}
+	}
+	return false
+}
+
+// floatValuesInWindow returns the float64 values within the specified time window
+func (c *Cache[T]) floatValuesInWindow(window string) ([]float64, error) {
+	points, err := c.floatPointsInWindow(window)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]float64, len(points))
+	for i, point := range points {
+		values[i] = point.Value
+	}
+	return values, nil
+}
+
+// floatPointsInWindow returns the float64 points within the specified time window.
+// NaN and Inf values are skipped when SkipNonFinite is set, otherwise they cause an error.
+func (c *Cache[T]) floatPointsInWindow(window string) ([]Point[float64], error) {
+	if c == nil {
+		return nil, fmt.Errorf("cache is nil")
+	}
+	return c.floatPoints(c.getPointsInWindow(window))
+}
+
+// floatPoints converts a window snapshot to float64 points, honoring SkipNonFinite
+func (c *Cache[T]) floatPoints(points []Point[T]) ([]Point[float64], error) {
+	if len(points) == 0 {
+		return nil, fmt.Errorf("no data yet")
+	}
+
+	result := make([]Point[float64], 0, len(points))
+	for _, point := range points {
+		val, ok := any(point.Value).(float64)
+		if !ok {
+			return nil, errors.New("value is not a float64 type")
+		}
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			if c.SkipNonFinite {
+				continue
+			}
+			return nil, errors.New("window contains NaN or Inf values")
+		}
+		result = append(result, Point[float64]{Value: val, Timestamp: point.Timestamp})
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no data yet")
+	}
+	return result, nil
+}
+
 // PctChange calculates Percentage Change between the latest two points
 func (c *Cache[T]) PctChange() (float64, error) {
 	if c == nil {
@@ -180,13 +680,14 @@ func (c *Cache[T]) PctChange() (float64, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	if len(c.Points) < 2 {
+	previous, current, ok := c.latestPairUnsafe()
+	if !ok {
 		return 0, fmt.Errorf("not enough data points")
 	}
 
 	// 获取最新的两个点
-	currentVal, ok1 := any(c.Points[len(c.Points)-1].Value).(float64)
-	previousVal, ok2 := any(c.Points[len(c.Points)-2].Value).(float64)
+	currentVal, ok1 := any(current).(float64)
+	previousVal, ok2 := any(previous).(float64)
 
 	if !ok1 || !ok2 {
 		return 0, errors.New("value is not a float64 type")
@@ -245,13 +746,14 @@ func (c *Cache[T]) Diff() (float64, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	if len(c.Points) < 2 {
+	previous, current, ok := c.latestPairUnsafe()
+	if !ok {
 		return 0, fmt.Errorf("not enough data points")
 	}
 
 	// 获取最新的两个点
-	currentVal, ok1 := any(c.Points[len(c.Points)-1].Value).(float64)
-	previousVal, ok2 := any(c.Points[len(c.Points)-2].Value).(float64)
+	currentVal, ok1 := any(current).(float64)
+	previousVal, ok2 := any(previous).(float64)
 
 	if !ok1 || !ok2 {
 		return 0, errors.New("value is not a float64 type")
@@ -286,7 +788,8 @@ func (c *Cache[T]) DiffWith(val float64) (float64, error) {
 	return difference, nil
 }
 
-// PctChangeExceeds checks if the percentage change between the latest two points exceeds the specified threshold
+// PctChangeExceeds checks if the percentage change between the latest two points reaches the specified threshold.
+// The threshold is inclusive; Epsilon is in value units and does not apply to percentages.
 func (c *Cache[T]) PctChangeExceeds(threshold float64) (bool, error) {
 	if c == nil {
 		return false, fmt.Errorf("cache is nil")
@@ -296,11 +799,11 @@ func (c *Cache[T]) PctChangeExceeds(threshold float64) (bool, error) {
 		return false, err
 	}
 
-	// 使用绝对值比较，因为超过阈值可能是正向或负向的
-	return math.Abs(pctChange) > threshold, nil
+	return math.Abs(pctChange) >= threshold, nil
 }
 
-// DiffExceeds checks if the absolute difference between the latest two points exceeds the specified threshold
+// DiffExceeds checks if the absolute difference between the latest two points reaches the specified threshold.
+// The threshold is inclusive and widened by Epsilon, matching push change detection.
 func (c *Cache[T]) DiffExceeds(threshold float64) (bool, error) {
 	if c == nil {
 		return false, fmt.Errorf("cache is nil")
@@ -310,8 +813,14 @@ func (c *Cache[T]) DiffExceeds(threshold float64) (bool, error) {
 		return false, err
 	}
 
+	return c.reachesThreshold(diff, threshold), nil
+}
+
+// reachesThreshold reports whether the value-unit |delta| >= threshold, treating values within Epsilon
+// below the threshold as reaching it so floating jitter at the boundary behaves consistently
+func (c *Cache[T]) reachesThreshold(delta, threshold float64) bool {
 	// 使用绝对值比较，因为超过阈值可能是正向或负向的
-	return math.Abs(diff) > threshold, nil
+	return math.Abs(delta) >= threshold-c.Epsilon
 }
 
 // Changed checks if the latest two values are different
@@ -323,12 +832,42 @@ func (c *Cache[T]) Changed() bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	if len(c.Points) < 2 {
+	previous, current, ok := c.latestPairUnsafe()
+	if !ok {
 		return false
 	}
 
 	// 比较最新的两个点的值是否不同
-	return !isValueEqual(c.Points[len(c.Points)-1].Value, c.Points[len(c.Points)-2].Value)
+	return !c.valuesEqual(current, previous)
+}
+
+// TimeSinceChange returns how long the latest value has been held, measured from the first point
+// after the most recent differing value. It returns 0 when all cached values are equal.
+func (c *Cache[T]) TimeSinceChange() (time.Duration, error) {
+	if c == nil {
+		return 0, fmt.Errorf("cache is nil")
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(c.Points) == 0 {
+		return 0, fmt.Errorf("no data yet")
+	}
+
+	latest := c.Points[len(c.Points)-1].Value
+	for i := len(c.Points) - 2; i >= 0; i-- {
+		if c.valuesEqual(c.Points[i].Value, latest) {
+			continue
+		}
+		// 当前值从 i+1 点开始保持不变
+		changedAt := c.Points[i+1].Timestamp
+		if changedAt == nil {
+			return 0, fmt.Errorf("point has no timestamp")
+		}
+		return time.Since(*changedAt), nil
+	}
+	return 0, nil
 }
 
 // PctChangeSince calculates Percentage Change between the latest value and the value from the specified time window ago
@@ -344,126 +883,456 @@ func (c *Cache[T]) PctChangeSince(window string) (float64, error) {
 		return 0, fmt.Errorf("no data points available")
 	}
 
-	// 获取最新值
-	currentVal, ok := any(c.Points[len(c.Points)-1].Value).(float64)
-	if !ok {
-		return 0, errors.New("value is not a float64 type")
-	}
+	// 获取最新值
+	currentVal, ok := any(c.Points[len(c.Points)-1].Value).(float64)
+	if !ok {
+		return 0, errors.New("value is not a float64 type")
+	}
+
+	// 解析时间窗口
+	duration, err := time.ParseDuration(window)
+	if err != nil {
+		return 0, errors.New("invalid time window format")
+	}
+
+	// 计算目标时间点
+	now := time.Now()
+	targetTime := now.Add(-duration)
+
+	// 找到时间窗口前最接近的点
+	var baseVal float64
+	var found bool
+
+	for i := len(c.Points) - 1; i >= 0; i-- {
+		if c.Points[i].Timestamp != nil && c.Points[i].Timestamp.Before(targetTime) {
+			if val, ok := any(c.Points[i].Value).(float64); ok {
+				baseVal = val
+				found = true
+				break
+			} else {
+				return 0, errors.New("value is not a float64 type")
+			}
+		}
+	}
+
+	if !found {
+		return 0, errors.New("no data point found before the specified time window")
+	}
+
+	// 如果基准值为0，无法计算百分比变化
+	if baseVal == 0 {
+		if currentVal == 0 {
+			return 0, nil // 0到0没有变化
+		}
+		return 0, errors.New("cannot calculate percentage change from zero")
+	}
+
+	// 计算百分比变化：((current - base) / base) * 100
+	percentageChange := ((currentVal - baseVal) / baseVal) * 100
+	return percentageChange, nil
+}
+
+// DiffSince calculates the difference between the latest value and the value from the specified time window ago
+func (c *Cache[T]) DiffSince(window string) (float64, error) {
+	if c == nil {
+		return 0, fmt.Errorf("cache is nil")
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(c.Points) == 0 {
+		return 0, fmt.Errorf("no data points available")
+	}
+
+	// 获取最新值
+	currentVal, ok := any(c.Points[len(c.Points)-1].Value).(float64)
+	if !ok {
+		return 0, errors.New("value is not a float64 type")
+	}
+
+	// 解析时间窗口
+	duration, err := time.ParseDuration(window)
+	if err != nil {
+		return 0, errors.New("invalid time window format")
+	}
+
+	// 计算目标时间点
+	now := time.Now()
+	targetTime := now.Add(-duration)
+
+	// 找到时间窗口前最接近的点
+	var baseVal float64
+	var found bool
+
+	for i := len(c.Points) - 1; i >= 0; i-- {
+		if c.Points[i].Timestamp != nil && c.Points[i].Timestamp.Before(targetTime) {
+			if val, ok := any(c.Points[i].Value).(float64); ok {
+				baseVal = val
+				found = true
+				break
+			} else {
+				return 0, errors.New("value is not a float64 type")
+			}
+		}
+	}
+
+	if !found {
+		return 0, errors.New("no data point found before the specified time window")
+	}
+
+	// 计算差值：current - base
+	difference := currentVal - baseVal
+	return difference, nil
+}
+
+// Rate calculates the rate of change per second between the latest two points
+func (c *Cache[T]) Rate() (float64, error) {
+	if c == nil {
+		return 0, fmt.Errorf("cache is nil")
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	previous, current, ok := c.latestPairUnsafe()
+	if !ok {
+		return 0, fmt.Errorf("not enough data points")
+	}
+
+	currentVal, ok1 := any(current).(float64)
+	previousVal, ok2 := any(previous).(float64)
+	if !ok1 || !ok2 {
+		return 0, errors.New("value is not a float64 type")
+	}
+
+	// 压缩区间内最新值是区间起点的重复，斜率为 0
+	n := len(c.Points)
+	if c.runEnd != nil {
+		return rateBetween(currentVal, c.runEnd, previousVal, c.Points[n-1].Timestamp)
+	}
+	return rateBetween(currentVal, c.Points[n-1].Timestamp, previousVal, c.Points[n-2].Timestamp)
+}
+
+// RateSince calculates the rate of change per second between the latest value and the value from the specified time window ago
+func (c *Cache[T]) RateSince(window string) (float64, error) {
+	if c == nil {
+		return 0, fmt.Errorf("cache is nil")
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(c.Points) == 0 {
+		return 0, fmt.Errorf("no data points available")
+	}
+
+	// 获取最新值
+	current := c.Points[len(c.Points)-1]
+	currentVal, ok := any(current.Value).(float64)
+	if !ok {
+		return 0, errors.New("value is not a float64 type")
+	}
+
+	// 解析时间窗口
+	duration, err := time.ParseDuration(window)
+	if err != nil {
+		return 0, errors.New("invalid time window format")
+	}
+
+	targetTime := time.Now().Add(-duration)
+
+	// 找到时间窗口前最接近的点
+	for i := len(c.Points) - 1; i >= 0; i-- {
+		if c.Points[i].Timestamp != nil && c.Points[i].Timestamp.Before(targetTime) {
+			baseVal, ok := any(c.Points[i].Value).(float64)
+			if !ok {
+				return 0, errors.New("value is not a float64 type")
+			}
+			return rateBetween(currentVal, current.Timestamp, baseVal, c.Points[i].Timestamp)
+		}
+	}
+
+	return 0, errors.New("no data point found before the specified time window")
+}
+
+// rateBetween returns (current - base) / seconds between the two timestamps
+func rateBetween(currentVal float64, currentTs *time.Time, baseVal float64, baseTs *time.Time) (float64, error) {
+	if currentTs == nil || baseTs == nil {
+		return 0, errors.New("timestamp is missing")
+	}
+	seconds := currentTs.Sub(*baseTs).Seconds()
+	if seconds == 0 {
+		return 0, errors.New("timestamps are equal")
+	}
+	return (currentVal - baseVal) / seconds, nil
+}
+
+// IsWindowFull checks if the cache history reaches back to the start of the specified time window,
+// i.e. statistics over the window are not computed from a partially filled window
+func (c *Cache[T]) IsWindowFull(window string) bool {
+	if c == nil {
+		return false
+	}
+	w, err := parseWindow(window)
+	if err != nil {
+		return false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, point := range c.Points {
+		if point.Timestamp != nil && !point.Timestamp.After(w.start) {
+			return true
+		}
+	}
+	return false
+}
+
+// Span returns the time covered by the points within the specified time window (newest - oldest timestamp)
+func (c *Cache[T]) Span(window string) (time.Duration, error) {
+	if c == nil {
+		return 0, fmt.Errorf("cache is nil")
+	}
+	points := c.getPointsInWindow(window)
+	if len(points) < 2 {
+		return 0, nil
+	}
+
+	oldest := points[0].Timestamp
+	newest := points[len(points)-1].Timestamp
+	if oldest == nil || newest == nil {
+		return 0, errors.New("timestamp is missing")
+	}
+	return newest.Sub(*oldest), nil
+}
+
+// AvgInterval returns the mean gap between consecutive point timestamps within the specified time window,
+// or 0 when there are fewer than two points
+func (c *Cache[T]) AvgInterval(window string) (time.Duration, error) {
+	if c == nil {
+		return 0, fmt.Errorf("cache is nil")
+	}
+	if _, err := parseWindow(window); err != nil {
+		return 0, errors.New("invalid time window format")
+	}
+	points := c.getPointsInWindow(window)
+	if len(points) < 2 {
+		return 0, nil
+	}
+
+	var total time.Duration
+	for i := 1; i < len(points); i++ {
+		if points[i].Timestamp == nil || points[i-1].Timestamp == nil {
+			return 0, errors.New("timestamp is missing")
+		}
+		total += points[i].Timestamp.Sub(*points[i-1].Timestamp)
+	}
+	return total / time.Duration(len(points)-1), nil
+}
+
+func (c *Cache[T]) Count(window string) int {
+	points := c.getPointsInWindow(window)
+	if len(points) <= 1 {
+		return len(points)
+	}
+
+	// 计算数据变化次数，相邻重复的不计数
+	changeCount := 1 // 第一个点始终计数
+
+	for i := 1; i < len(points); i++ {
+		// 比较当前点与前一个点的值是否不同
+		if !c.valuesEqual(points[i].Value, points[i-1].Value) {
+			changeCount++
+		}
+	}
+
+	return changeCount
+}
+
+// IsFlapping reports whether the value changed more than maxTransitions times within the specified time window
+func (c *Cache[T]) IsFlapping(window string, maxTransitions int) (bool, error) {
+	if _, err := parseWindow(window); err != nil {
+		return false, errors.New("invalid time window format")
+	}
+	// Count 包含第一个点，变化次数需减一
+	transitions := c.Count(window) - 1
+	return transitions > maxTransitions, nil
+}
+
+// IsFlatlined reports whether samples keep arriving within the specified time window without the value
+// ever changing, e.g. a stuck sensor. Empty and single-sample windows are not flatlined. With Compress a
+// stored point that absorbed repeated values counts as multiple samples.
+func (c *Cache[T]) IsFlatlined(window string) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("cache is nil")
+	}
+	w, err := parseWindow(window)
+	if err != nil {
+		return false, errors.New("invalid time window format")
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// 单次遍历同一快照：相邻值出现变化即不是平线
+	samples, last := 0, -1
+	for i, point := range c.Points {
+		if !w.contains(point.Timestamp) {
+			continue
+		}
+		if samples > 0 && !c.valuesEqual(c.Points[last].Value, point.Value) {
+			return false, nil
+		}
+		samples++
+		last = i
+	}
+	if samples == 1 {
+		// 唯一的点是吸收了重复值的压缩区间时仍算多次采样
+		return last == len(c.Points)-1 && c.runEnd != nil, nil
+	}
+	return samples > 1, nil
+}
+
+// SampleCount returns the number of points within the specified time window, including repeated values.
+// With Compress a run of identical values counts as one point.
+func (c *Cache[T]) SampleCount(window string) int {
+	return len(c.getPointsInWindow(window))
+}
 
-	// 解析时间窗口
-	duration, err := time.ParseDuration(window)
+// DistinctValues returns the unique values within the specified time window in first-seen order
+func (c *Cache[T]) DistinctValues(window string) ([]T, error) {
+	distinct := []T{}
+	err := c.ForEachInWindow(window, func(p Point[T]) bool {
+		for _, v := range distinct {
+			if c.valuesEqual(v, p.Value) {
+				return true
+			}
+		}
+		distinct = append(distinct, p.Value)
+		return true
+	})
 	if err != nil {
-		return 0, errors.New("invalid time window format")
+		return nil, err
 	}
+	return distinct, nil
+}
 
-	// 计算目标时间点
-	now := time.Now()
-	targetTime := now.Add(-duration)
-
-	// 找到时间窗口前最接近的点
-	var baseVal float64
-	var found bool
-
-	for i := len(c.Points) - 1; i >= 0; i-- {
-		if c.Points[i].Timestamp != nil && c.Points[i].Timestamp.Before(targetTime) {
-			if val, ok := any(c.Points[i].Value).(float64); ok {
-				baseVal = val
+// Mode returns the most frequent value within the specified time window,
+// ties are broken by the most recent occurrence
+func (c *Cache[T]) Mode(window string) (T, error) {
+	var zero T
+	var values []T
+	var counts, lastSeen []int
+	i := 0
+	err := c.ForEachInWindow(window, func(p Point[T]) bool {
+		found := false
+		for j, v := range values {
+			if c.valuesEqual(v, p.Value) {
+				counts[j]++
+				lastSeen[j] = i
 				found = true
 				break
-			} else {
-				return 0, errors.New("value is not a float64 type")
 			}
 		}
+		if !found {
+			values = append(values, p.Value)
+			counts = append(counts, 1)
+			lastSeen = append(lastSeen, i)
+		}
+		i++
+		return true
+	})
+	if err != nil {
+		return zero, err
 	}
-
-	if !found {
-		return 0, errors.New("no data point found before the specified time window")
+	if len(values) == 0 {
+		return zero, fmt.Errorf("no data points available")
 	}
 
-	// 如果基准值为0，无法计算百分比变化
-	if baseVal == 0 {
-		if currentVal == 0 {
-			return 0, nil // 0到0没有变化
+	best := 0
+	for j := 1; j < len(values); j++ {
+		if counts[j] > counts[best] || (counts[j] == counts[best] && lastSeen[j] > lastSeen[best]) {
+			best = j
 		}
-		return 0, errors.New("cannot calculate percentage change from zero")
 	}
-
-	// 计算百分比变化：((current - base) / base) * 100
-	percentageChange := ((currentVal - baseVal) / baseVal) * 100
-	return percentageChange, nil
+	return values[best], nil
 }
 
-// DiffSince calculates the difference between the latest value and the value from the specified time window ago
-func (c *Cache[T]) DiffSince(window string) (float64, error) {
+// ForEachInWindow calls fn for each point within the specified time window in chronological order
+// without copying the points; iteration stops early when fn returns false.
+// The read lock is held during iteration, so fn must not call back into the cache.
+func (c *Cache[T]) ForEachInWindow(window string, fn func(Point[T]) bool) error {
 	if c == nil {
-		return 0, fmt.Errorf("cache is nil")
-	}
-
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	if len(c.Points) == 0 {
-		return 0, fmt.Errorf("no data points available")
-	}
-
-	// 获取最新值
-	currentVal, ok := any(c.Points[len(c.Points)-1].Value).(float64)
-	if !ok {
-		return 0, errors.New("value is not a float64 type")
+		return fmt.Errorf("cache is nil")
 	}
 
-	// 解析时间窗口
-	duration, err := time.ParseDuration(window)
+	w, err := parseWindow(window)
 	if err != nil {
-		return 0, errors.New("invalid time window format")
+		return errors.New("invalid time window format")
 	}
 
-	// 计算目标时间点
-	now := time.Now()
-	targetTime := now.Add(-duration)
-
-	// 找到时间窗口前最接近的点
-	var baseVal float64
-	var found bool
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
-	for i := len(c.Points) - 1; i >= 0; i-- {
-		if c.Points[i].Timestamp != nil && c.Points[i].Timestamp.Before(targetTime) {
-			if val, ok := any(c.Points[i].Value).(float64); ok {
-				baseVal = val
-				found = true
+	for _, point := range c.Points {
+		if w.contains(point.Timestamp) {
+			if !fn(point) {
 				break
-			} else {
-				return 0, errors.New("value is not a float64 type")
 			}
 		}
 	}
+	return nil
+}
 
-	if !found {
-		return 0, errors.New("no data point found before the specified time window")
-	}
-
-	// 计算差值：current - base
-	difference := currentVal - baseVal
-	return difference, nil
+// ToCSV writes all points as timestamp,value rows under a header, formatting []byte values as hex
+func (c *Cache[T]) ToCSV(w io.Writer) error {
+	return c.writeCSV(w, nil, nil)
 }
 
-func (c *Cache[T]) Count(window string) int {
-	points := c.getPointsInWindow(window)
-	if len(points) <= 1 {
-		return len(points)
+// writeCSV writes the points with the given leading columns, e.g. the variable key
+func (c *Cache[T]) writeCSV(w io.Writer, prefix []string, loc *time.Location) error {
+	if c == nil {
+		return fmt.Errorf("cache is nil")
 	}
 
-	// 计算数据变化次数，相邻重复的不计数
-	changeCount := 1 // 第一个点始终计数
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
-	for i := 1; i < len(points); i++ {
-		// 比较当前点与前一个点的值是否不同
-		if !isValueEqual(points[i].Value, points[i-1].Value) {
-			changeCount++
+	cw := csv.NewWriter(w)
+	header := []string{"timestamp", "value"}
+	if len(prefix) > 0 {
+		header = []string{"key", "timestamp", "value"}
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, point := range c.Points {
+		ts := ""
+		if point.Timestamp != nil && loc != nil {
+			ts = point.Timestamp.In(loc).Format(time.RFC3339Nano)
+		} else if point.Timestamp != nil {
+			ts = point.Timestamp.Format(time.RFC3339Nano)
+		}
+		row := append(append([]string{}, prefix...), ts, formatCSVValue(point.Value))
+		if err := cw.Write(row); err != nil {
+			return err
 		}
 	}
+	cw.Flush()
+	return cw.Error()
+}
 
-	return changeCount
+func formatCSVValue(value any) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []byte:
+		return hex.EncodeToString(v)
+	default:
+		return fmt.Sprint(v)
+	}
 }
 
 // getPointsInWindow gets points within the specified time window
@@ -481,7 +1350,7 @@ func (c *Cache[T]) getPointsInWindow(window string) []Point[T] {
 	}
 
 	// 解析时间窗口字符串
-	duration, err := time.ParseDuration(window)
+	w, err := parseWindow(window)
 	if err != nil {
 		// 如果解析失败，返回所有点的副本
 		result := make([]Point[T], len(c.Points))
@@ -489,12 +1358,9 @@ func (c *Cache[T]) getPointsInWindow(window string) []Point[T] {
 		return result
 	}
 
-	now := time.Now()
-	cutoffTime := now.Add(-duration)
-
 	var result []Point[T]
 	for _, point := range c.Points {
-		if point.Timestamp != nil && point.Timestamp.After(cutoffTime) {
+		if w.contains(point.Timestamp) {
 			result = append(result, point)
 		}
 	}
@@ -502,6 +1368,66 @@ func (c *Cache[T]) getPointsInWindow(window string) []Point[T] {
 	return result
 }
 
+// timeWindow is a parsed window: points after start and, when end is set, not after end
+type timeWindow struct {
+	start time.Time
+	end   *time.Time
+}
+
+// parseWindow parses a window string relative to now.
+// A single duration like "5m" selects the last 5 minutes.
+// A "start:end" band like "5m:1m" (or "now-5m:now-1m") selects from 5 minutes ago up to 1 minute ago.
+func parseWindow(window string) (timeWindow, error) {
+	now := time.Now()
+	startStr, endStr, isBand := strings.Cut(window, ":")
+
+	startAgo, err := parseRelativeDuration(startStr)
+	if err != nil {
+		return timeWindow{}, err
+	}
+	w := timeWindow{start: now.Add(-startAgo)}
+	if !isBand {
+		return w, nil
+	}
+
+	endAgo, err := parseRelativeDuration(endStr)
+	if err != nil {
+		return timeWindow{}, err
+	}
+	if endAgo > startAgo {
+		return timeWindow{}, fmt.Errorf("invalid time window %q: start must be before end", window)
+	}
+	end := now.Add(-endAgo)
+	w.end = &end
+	return w, nil
+}
+
+// parseRelativeDuration parses "5m", "now-5m" or "now" into how long ago the anchor is
+func parseRelativeDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "now" {
+		return 0, nil
+	}
+	s = strings.TrimPrefix(s, "now-")
+	return time.ParseDuration(s)
+}
+
+// contains reports whether the timestamp falls within the window
+func (w timeWindow) contains(ts *time.Time) bool {
+	if ts == nil || !ts.After(w.start) {
+		return false
+	}
+	return w.end == nil || !ts.After(*w.end)
+}
+
+// valuesEqual compares two values, allowing float64 values to differ by up to Epsilon
+func (c *Cache[T]) valuesEqual(a, b T) bool {
+	if af, ok := any(a).(float64); ok && c.Epsilon > 0 {
+		return math.Abs(af-any(b).(float64)) <= c.Epsilon
+	}
+	return isValueEqual(a, b)
+}
+
 // 辅助函数：比较两个值是否相等，处理不同类型
 func isValueEqual[T float64 | bool | string | []byte](a, b T) bool {
 	// 使用 any 类型转换来处理不同类型的比较
@@ -700,6 +1626,68 @@ func (c *Cache[T]) ByteBit(n, i int) (bool, error) {
 	}
 }
 
+// ChangedBits returns the indices of the bits that differ between the latest and previous []byte values,
+// numbered from the least significant bit of the first byte
+func (c *Cache[T]) ChangedBits() ([]int, error) {
+	if c == nil {
+		return nil, fmt.Errorf("cache is nil")
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(c.Points) < 2 {
+		return nil, fmt.Errorf("not enough data points")
+	}
+
+	latest, ok := any(c.Points[len(c.Points)-1].Value).([]byte)
+	if !ok {
+		return nil, fmt.Errorf("value is not a []byte type")
+	}
+	previous := any(c.Points[len(c.Points)-2].Value).([]byte)
+	if len(latest) != len(previous) {
+		return nil, fmt.Errorf("byte length changed from %d to %d", len(previous), len(latest))
+	}
+
+	bits := []int{}
+	for n := range latest {
+		diff := latest[n] ^ previous[n]
+		for i := 0; i < 8; i++ {
+			if diff&(1<<i) != 0 {
+				bits = append(bits, n*8+i)
+			}
+		}
+	}
+	return bits, nil
+}
+
+// WordAt returns the n-th 16-bit word (register) of the latest []byte value, at byte offset 2*n
+func (c *Cache[T]) WordAt(n int, littleEndian bool) (uint16, error) {
+	if c == nil {
+		return 0, fmt.Errorf("cache is nil")
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(c.Points) == 0 {
+		return 0, fmt.Errorf("no data points available")
+	}
+
+	val, ok := any(c.Points[len(c.Points)-1].Value).([]byte)
+	if !ok {
+		return 0, errors.New("value is not a []byte type")
+	}
+	// 检查字索引是否有效
+	if n < 0 || 2*n+2 > len(val) {
+		return 0, errors.New("word index out of range")
+	}
+	if littleEndian {
+		return binary.LittleEndian.Uint16(val[2*n:]), nil
+	}
+	return binary.BigEndian.Uint16(val[2*n:]), nil
+}
+
 // BitAnd performs a bitwise AND operation between the latest []byte value and the mask
 // The []byte value is interpreted as a Little-Endian integer
 func (c *Cache[T]) BitAnd(mask uint64) (uint, error) {
@@ -868,18 +1856,87 @@ func (c *Cache[T]) AddPoint(value T, timestamp *time.Time) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	c.addPointUnsafe(value, timestamp)
+	c.cleanExpiredPointsUnsafe()
+}
+
+// AddPoints inserts a batch of points under a single lock and expiry pass, e.g. when backfilling history.
+// Points without timestamp get the current time. The cache is kept in timestamp order; with RejectOutOfOrder
+// points older than the newest stored one are dropped.
+func (c *Cache[T]) AddPoints(points []Point[T]) {
+	if c == nil || len(points) == 0 {
+		return
+	}
+
+	now := time.Now()
+	batch := make([]Point[T], len(points))
+	copy(batch, points)
+	for i := range batch {
+		if batch[i].Timestamp == nil {
+			batch[i].Timestamp = &now
+		}
+	}
+	sort.SliceStable(batch, func(i, j int) bool { return batch[i].Timestamp.Before(*batch[j].Timestamp) })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, p := range batch {
+		c.addPointUnsafe(p.Value, p.Timestamp)
+	}
+	// 回填的历史数据可能早于已有的点
+	if !sort.SliceIsSorted(c.Points, c.pointBeforeUnsafe) {
+		sort.SliceStable(c.Points, c.pointBeforeUnsafe)
+		c.runEnd = nil
+		c.oldest = time.Time{}
+	}
+	c.cleanExpiredPointsUnsafe()
+}
+
+func (c *Cache[T]) pointBeforeUnsafe(i, j int) bool {
+	a, b := c.Points[i].Timestamp, c.Points[j].Timestamp
+	return a != nil && b != nil && a.Before(*b)
+}
+
+func (c *Cache[T]) addPointUnsafe(value T, timestamp *time.Time) {
+	if c.RejectOutOfOrder {
+		if latest := c.latestTimestampUnsafe(); latest != nil && timestamp.Before(*latest) {
+			return
+		}
+	}
 	// 检查是否已经存在相同timestamp的point
 	for i, point := range c.Points {
 		if point.Timestamp != nil && timestamp != nil && point.Timestamp.Equal(*timestamp) {
 			// 如果存在相同的时间戳，更新值并返回
 			c.Points[i].Value = value
-			c.cleanExpiredPointsUnsafe()
 			return
 		}
 	}
 
+	// 压缩模式下重复值只记录区间结束时间
+	if c.Compress && len(c.Points) > 0 {
+		latest := c.Points[len(c.Points)-1]
+		if latest.Timestamp != nil && timestamp.After(*latest.Timestamp) && c.valuesEqual(value, latest.Value) {
+			// 区间内迟到的重复值不回退区间结束时间
+			if c.runEnd == nil || timestamp.After(*c.runEnd) {
+				c.runEnd = timestamp
+			}
+			return
+		}
+	}
+
+	if c.LazyExpiration && !c.oldest.IsZero() {
+		bound := *timestamp
+		// 结束的压缩区间改按起点过期，过期基准须随之下调
+		if n := len(c.Points); c.runEnd != nil && c.Points[n-1].Timestamp != nil && c.Points[n-1].Timestamp.Before(bound) {
+			bound = *c.Points[n-1].Timestamp
+		}
+		if bound.Before(c.oldest) {
+			c.oldest = bound
+		}
+	}
 	c.Points = append(c.Points, Point[T]{Value: value, Timestamp: timestamp})
-	c.cleanExpiredPointsUnsafe()
+	c.runEnd = nil
 }
 
 func (c *Cache[T]) cleanExpiredPointsUnsafe() {
@@ -888,10 +1945,14 @@ func (c *Cache[T]) cleanExpiredPointsUnsafe() {
 	}
 
 	now := time.Now()
+	if c.LazyExpiration {
+		c.cleanExpiredPointsLazyUnsafe(now)
+		return
+	}
 	validPoints := make([]Point[T], 0, len(c.Points))
 
-	for _, point := range c.Points {
-		if point.Timestamp != nil && now.Sub(*point.Timestamp) <= c.ExpireDuration {
+	for i, point := range c.Points {
+		if !c.expiredUnsafe(i, now) {
 			validPoints = append(validPoints, point)
 		}
 	}
@@ -899,5 +1960,139 @@ func (c *Cache[T]) cleanExpiredPointsUnsafe() {
 	c.Points = validPoints
 }
 
+// latestPairUnsafe returns the latest two samples. With Compress a run that absorbed repeated values
+// counts as a repeat of the latest value, so it compares equal as it would without compression.
+func (c *Cache[T]) latestPairUnsafe() (previous, current T, ok bool) {
+	n := len(c.Points)
+	if n >= 1 && c.runEnd != nil {
+		return c.Points[n-1].Value, c.Points[n-1].Value, true
+	}
+	if n < 2 {
+		return previous, current, false
+	}
+	return c.Points[n-2].Value, c.Points[n-1].Value, true
+}
+
+// expiredUnsafe reports whether point i is older than ExpireDuration. A compressed latest point
+// expires by the end of its run.
+func (c *Cache[T]) expiredUnsafe(i int, now time.Time) bool {
+	ts := c.expiryTimestampUnsafe(i)
+	return ts == nil || now.Sub(*ts) > c.ExpireDuration
+}
+
+// expiryTimestampUnsafe returns the timestamp point i expires by: its own, or the run end for a compressed latest point
+func (c *Cache[T]) expiryTimestampUnsafe(i int) *time.Time {
+	if i == len(c.Points)-1 && c.runEnd != nil {
+		return c.runEnd
+	}
+	return c.Points[i].Timestamp
+}
+
+// cleanExpiredPointsLazyUnsafe prunes only when the oldest point has expired, filtering in place.
+// A compressed latest point is tracked by its run end, so an active run does not force a scan on every add.
+func (c *Cache[T]) cleanExpiredPointsLazyUnsafe(now time.Time) {
+	// 最旧的点未过期时无需清理
+	if !c.oldest.IsZero() && now.Sub(c.oldest) <= c.ExpireDuration {
+		return
+	}
+
+	validPoints := c.Points[:0]
+	c.oldest = time.Time{}
+	for i, point := range c.Points {
+		if !c.expiredUnsafe(i, now) {
+			validPoints = append(validPoints, point)
+			if ts := c.expiryTimestampUnsafe(i); c.oldest.IsZero() || ts.Before(c.oldest) {
+				c.oldest = *ts
+			}
+		}
+	}
+	// 清除尾部的旧数据，释放引用
+	clear(c.Points[len(validPoints):])
+	c.Points = validPoints
+}
+
+// InterpolateAt linearly interpolates the value of c at t between the bracketing points. It returns false
+// when t is outside the cached range. It is a function rather than a method so that only numeric caches have it.
+// Like ValueAt it scans every point, so out-of-order writes are handled.
+func InterpolateAt(c *Cache[float64], t time.Time) (float64, bool) {
+	if c == nil {
+		return 0, false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// prev 为不晚于 t 的最新点，next 为不早于 t 的最早点
+	var prev, next *Point[float64]
+	for i := range c.Points {
+		point := &c.Points[i]
+		if point.Timestamp == nil {
+			continue
+		}
+		if !point.Timestamp.After(t) && (prev == nil || !point.Timestamp.Before(*prev.Timestamp)) {
+			prev = point
+		}
+		if !point.Timestamp.Before(t) && (next == nil || point.Timestamp.Before(*next.Timestamp)) {
+			next = point
+		}
+	}
+	if prev == nil || next == nil {
+		return 0, false
+	}
+	if prev.Timestamp.Equal(t) {
+		return prev.Value, true
+	}
+	span := next.Timestamp.Sub(*prev.Timestamp)
+	ratio := float64(t.Sub(*prev.Timestamp)) / float64(span)
+	return prev.Value + (next.Value-prev.Value)*ratio, true
+}
+
+// Correlation returns the Pearson correlation coefficient of a and b within the specified time window.
+// Each point of a is paired with the value of b in effect at its timestamp (see ValueAt),
+// so the caches do not need to share sampling times.
+func Correlation(a, b *Cache[float64], window string) (float64, error) {
+	if a == nil || b == nil {
+		return 0, fmt.Errorf("cache is nil")
+	}
+	if _, err := parseWindow(window); err != nil {
+		return 0, errors.New("invalid time window format")
+	}
+
+	var xs, ys []float64
+	for _, point := range a.getPointsInWindow(window) {
+		if point.Timestamp == nil {
+			continue
+		}
+		if y, ok := b.ValueAt(*point.Timestamp); ok {
+			xs = append(xs, point.Value)
+			ys = append(ys, y)
+		}
+	}
+	if len(xs) < 3 {
+		return 0, fmt.Errorf("not enough data points")
+	}
+
+	// 计算平均值
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= float64(len(xs))
+	meanY /= float64(len(ys))
+
+	var cov, varX, varY float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return 0, errors.New("correlation is undefined for a constant signal")
+	}
+	return cov / math.Sqrt(varX*varY), nil
+}
+
 // TODO:  增加功能： 某个时间段的变化值
 // TODO: 取bit
@@ -0,0 +1,92 @@
+package edgeexpr
+
+import (
+	"reflect"
+	"strings"
+)
+
+// MethodInfo describes a Cache method callable from scripts
+// Types that depend on the cache's value type are written with T, e.g. "[]Point[T]"
+type MethodInfo struct {
+	Name    string   `json:"name"`
+	Args    []string `json:"args"`
+	Returns []string `json:"returns"`
+}
+
+// cacheMutators are exported Cache methods that modify the cache and are not meant for scripts
+var cacheMutators = map[string]bool{"AddPoint": true, "AddPoints": true}
+
+// CacheMethods returns the script-callable methods of Cache in name order, built by reflection over the
+// concrete cache types. Mutators and methods expr cannot call, e.g. with more than two results or
+// callback and io parameters, are left out.
+func CacheMethods() []MethodInfo {
+	instances := []struct {
+		t     reflect.Type
+		param string
+	}{
+		{reflect.TypeOf(&Cache[float64]{}), "float64"},
+		{reflect.TypeOf(&Cache[bool]{}), "bool"},
+		{reflect.TypeOf(&Cache[string]{}), "string"},
+		{reflect.TypeOf(&Cache[[]byte]{}), "[]uint8"},
+	}
+
+	base := instances[0]
+	methods := make([]MethodInfo, 0, base.t.NumMethod())
+	for i := 0; i < base.t.NumMethod(); i++ {
+		method := base.t.Method(i)
+		if !scriptCallable(method) {
+			continue
+		}
+		info := MethodInfo{
+			Name:    method.Name,
+			Args:    make([]string, 0, method.Type.NumIn()-1),
+			Returns: make([]string, 0, method.Type.NumOut()),
+		}
+
+		// typeName 比较各实例化类型，同一位置类型不一致时说明依赖类型参数
+		typeName := func(position func(reflect.Type) reflect.Type) string {
+			name := typeString(position(method.Type))
+			for _, inst := range instances[1:] {
+				other, ok := inst.t.MethodByName(method.Name)
+				if !ok || typeString(position(other.Type)) != name {
+					return strings.ReplaceAll(name, base.param, "T")
+				}
+			}
+			return name
+		}
+
+		// 第 0 个参数是接收者
+		for in := 1; in < method.Type.NumIn(); in++ {
+			info.Args = append(info.Args, typeName(func(t reflect.Type) reflect.Type { return t.In(in) }))
+		}
+		for out := 0; out < method.Type.NumOut(); out++ {
+			info.Returns = append(info.Returns, typeName(func(t reflect.Type) reflect.Type { return t.Out(out) }))
+		}
+		methods = append(methods, info)
+	}
+	return methods
+}
+
+// scriptCallable reports whether a script can call method: expr requires one or two results,
+// and scripts cannot build callbacks, writers or points to pass as arguments
+func scriptCallable(method reflect.Method) bool {
+	if cacheMutators[method.Name] || method.Type.NumOut() == 0 || method.Type.NumOut() > 2 {
+		return false
+	}
+	// 第 0 个参数是接收者
+	for in := 1; in < method.Type.NumIn(); in++ {
+		t := method.Type.In(in)
+		for t.Kind() == reflect.Slice || t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Func || t.Kind() == reflect.Interface || strings.HasPrefix(t.Name(), "Point[") {
+			return false
+		}
+	}
+	return true
+}
+
+// typeString returns the type name without the package qualifier
+func typeString(t reflect.Type) string {
+	return strings.ReplaceAll(t.String(), "edgeexpr.", "")
+}
@@ -0,0 +1,39 @@
+package edgeexpr
+
+import "testing"
+
+func TestCacheMethods(t *testing.T) {
+	methods := make(map[string]MethodInfo)
+	for _, m := range CacheMethods() {
+		methods[m.Name] = m
+	}
+
+	for _, name := range []string{"MA", "Bit", "Rising", "Value", "LastN"} {
+		if _, ok := methods[name]; !ok {
+			t.Errorf("Expected method %s to be listed", name)
+		}
+	}
+
+	// 修改缓存或脚本无法调用的方法不列出
+	for _, name := range []string{"AddPoint", "AddPoints", "ArgMax", "ArgMin", "Nearest", "ForEachInWindow", "ToCSV"} {
+		if _, ok := methods[name]; ok {
+			t.Errorf("Expected method %s not to be listed", name)
+		}
+	}
+
+	ma := methods["MA"]
+	if len(ma.Args) != 1 || ma.Args[0] != "string" {
+		t.Errorf("Expected MA to take a single string, got %v", ma.Args)
+	}
+	if len(ma.Returns) != 2 || ma.Returns[0] != "float64" || ma.Returns[1] != "error" {
+		t.Errorf("Expected MA to return (float64, error), got %v", ma.Returns)
+	}
+
+	// 依赖类型参数的返回值以 T 表示
+	if value := methods["Value"]; len(value.Returns) != 1 || value.Returns[0] != "T" {
+		t.Errorf("Expected Value to return T, got %v", value.Returns)
+	}
+	if lastN := methods["LastN"]; len(lastN.Returns) != 1 || lastN.Returns[0] != "[]Point[T]" {
+		t.Errorf("Expected LastN to return []Point[T], got %v", lastN.Returns)
+	}
+}
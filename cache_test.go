@@ -0,0 +1,1190 @@
+package edgeexpr
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 辅助函数：按固定间隔向缓存写入数据点，最新的点时间为 now
+func fillCache[T float64 | bool | string | []byte](c *Cache[T], interval time.Duration, values ...T) time.Time {
+	now := time.Now()
+	for i, v := range values {
+		ts := now.Add(-time.Duration(len(values)-1-i) * interval)
+		c.AddPoint(v, &ts)
+	}
+	return now
+}
+
+func TestCache_LastN(t *testing.T) {
+	cache := NewCache[float64](time.Minute)
+	fillCache(cache, time.Second, 1, 2, 3, 4)
+
+	points := cache.LastN(3)
+	if len(points) != 3 {
+		t.Fatalf("Expected 3 points, got %d", len(points))
+	}
+	for i, expected := range []float64{2, 3, 4} {
+		if points[i].Value != expected {
+			t.Errorf("Expected point %d to be %v, got %v", i, expected, points[i].Value)
+		}
+	}
+
+	if got := len(cache.LastN(10)); got != 4 {
+		t.Errorf("Expected all 4 points when n exceeds count, got %d", got)
+	}
+
+	if got := cache.LastN(0); got == nil || len(got) != 0 {
+		t.Errorf("Expected empty slice for n <= 0, got %v", got)
+	}
+}
+
+func TestCache_IsStale(t *testing.T) {
+	cache := NewCache[float64](time.Minute)
+
+	stale, err := cache.IsStale("30s")
+	if err != nil || !stale {
+		t.Errorf("Expected empty cache to be stale, got %v, %v", stale, err)
+	}
+
+	old := time.Now().Add(-45 * time.Second)
+	cache.AddPoint(1, &old)
+	if stale, _ := cache.IsStale("30s"); !stale {
+		t.Error("Expected cache to be stale when latest point is older than maxAge")
+	}
+
+	cache.AddPoint(2, nil)
+	if stale, _ := cache.IsStale("30s"); stale {
+		t.Error("Expected cache not to be stale after a fresh point")
+	}
+
+	if _, err := cache.IsStale("abc"); err == nil {
+		t.Error("Expected error for invalid duration")
+	}
+}
+
+func TestCache_TWA(t *testing.T) {
+	cache := NewCache[float64](time.Minute)
+	now := time.Now()
+	t1 := now.Add(-10 * time.Second)
+	t2 := now.Add(-9 * time.Second)
+	cache.AddPoint(100, &t1) // 持续 1 秒
+	cache.AddPoint(0, &t2)   // 持续约 9 秒
+
+	twa, err := cache.TWA("30s")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// 算术平均为 50，时间加权平均约为 10
+	if twa < 9 || twa > 11 {
+		t.Errorf("Expected time-weighted average around 10, got %v", twa)
+	}
+
+	single := NewCache[float64](time.Minute)
+	single.AddPoint(42, nil)
+	if twa, err := single.TWA("30s"); err != nil || twa != 42 {
+		t.Errorf("Expected single point value 42, got %v, %v", twa, err)
+	}
+
+	boolCache := NewCache[bool](time.Minute)
+	boolCache.AddPoint(true, nil)
+	if _, err := boolCache.TWA("30s"); err == nil {
+		t.Error("Expected type error for bool cache")
+	}
+}
+
+func TestCache_Rate(t *testing.T) {
+	cache := NewCache[float64](time.Minute)
+	fillCache(cache, time.Second, 10, 12, 15)
+
+	rate, err := cache.Rate()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rate != 3 {
+		t.Errorf("Expected rate 3/s, got %v", rate)
+	}
+
+	// 1.5 秒前的基准点为 10，与最新值相隔 2 秒
+	rate, err = cache.RateSince("1500ms")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rate != 2.5 {
+		t.Errorf("Expected windowed rate 2.5/s, got %v", rate)
+	}
+
+	if _, err := cache.RateSince("1m"); err == nil {
+		t.Error("Expected error when no point precedes the window")
+	}
+
+	single := NewCache[float64](time.Minute)
+	single.AddPoint(1, nil)
+	if _, err := single.Rate(); err == nil {
+		t.Error("Expected error with fewer than two points")
+	}
+
+	boolCache := NewCache[bool](time.Minute)
+	fillCache(boolCache, time.Second, false, true)
+	if _, err := boolCache.Rate(); err == nil {
+		t.Error("Expected type error for bool cache")
+	}
+}
+
+func TestCache_Aggregate(t *testing.T) {
+	cache := NewCache[float64](time.Minute)
+	fillCache(cache, time.Second, 4, 1, 3, 2)
+
+	expected := map[string]float64{
+		"mean":   2.5,
+		"min":    1,
+		"max":    4,
+		"sum":    10,
+		"stddev": 1.118033988749895,
+		"median": 2.5,
+	}
+	for fn, want := range expected {
+		got, err := cache.Aggregate(fn, "30s")
+		if err != nil {
+			t.Errorf("Aggregate(%q) returned error: %v", fn, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("Aggregate(%q) = %v, expected %v", fn, got, want)
+		}
+	}
+
+	if _, err := cache.Aggregate("mode", "30s"); err == nil {
+		t.Error("Expected error for unknown aggregation function")
+	}
+}
+
+func TestCache_Previous(t *testing.T) {
+	cache := NewCache[float64](time.Minute)
+
+	if _, ok := cache.Previous(); ok {
+		t.Error("Expected no previous value for empty cache")
+	}
+
+	fillCache(cache, time.Second, 1, 2, 3)
+
+	if val, ok := cache.Previous(); !ok || val != 2 {
+		t.Errorf("Expected previous value 2, got %v, %v", val, ok)
+	}
+	if val, ok := cache.PreviousN(2); !ok || val != 1 {
+		t.Errorf("Expected value 1 two samples back, got %v, %v", val, ok)
+	}
+	if val, ok := cache.PreviousN(3); ok || val != 0 {
+		t.Errorf("Expected zero value and false beyond history, got %v, %v", val, ok)
+	}
+}
+
+func TestCache_InRecentRange(t *testing.T) {
+	cache := NewCache[float64](time.Hour)
+
+	if in, err := cache.InRecentRange("10m", 5); err != nil || !in {
+		t.Errorf("Expected empty cache to be in range, got %v, %v", in, err)
+	}
+
+	// 窗口外的旧点不参与区间计算
+	old := time.Now().Add(-20 * time.Minute)
+	cache.AddPoint(1000, &old)
+	fillCache(cache, time.Second, 10, 20, 15)
+
+	if in, _ := cache.InRecentRange("10m", 0); !in {
+		t.Error("Expected latest value 15 to be within [10, 20]")
+	}
+
+	cache.AddPoint(20.4, nil)
+	if in, _ := cache.InRecentRange("10m", 0); in {
+		t.Error("Expected latest value 20.4 to be outside [10, 20] without margin")
+	}
+	if in, _ := cache.InRecentRange("10m", 5); !in {
+		t.Error("Expected latest value 20.4 to be within [9.5, 20.5] with 5% margin")
+	}
+
+	boolCache := NewCache[bool](time.Minute)
+	boolCache.AddPoint(true, nil)
+	if _, err := boolCache.InRecentRange("10m", 5); err == nil {
+		t.Error("Expected type error for bool cache")
+	}
+}
+
+func TestCache_ForEachInWindow(t *testing.T) {
+	cache := NewCache[float64](time.Hour)
+	old := time.Now().Add(-10 * time.Minute)
+	cache.AddPoint(100, &old)
+	fillCache(cache, time.Second, 1, 2, 3, 4)
+
+	var visited []float64
+	err := cache.ForEachInWindow("1m", func(p Point[float64]) bool {
+		visited = append(visited, p.Value)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(visited) != 4 || visited[0] != 1 || visited[3] != 4 {
+		t.Errorf("Expected to visit [1 2 3 4], got %v", visited)
+	}
+
+	visited = nil
+	cache.ForEachInWindow("1m", func(p Point[float64]) bool {
+		visited = append(visited, p.Value)
+		return p.Value < 2
+	})
+	if len(visited) != 2 {
+		t.Errorf("Expected iteration to stop after 2 points, got %v", visited)
+	}
+
+	if err := cache.ForEachInWindow("bad", func(Point[float64]) bool { return true }); err == nil {
+		t.Error("Expected error for invalid window")
+	}
+}
+
+func TestCache_RelativeWindow(t *testing.T) {
+	cache := NewCache[float64](time.Hour)
+	fillCache(cache, time.Minute, 1, 2, 3, 4, 5, 6) // 5m, 4m, 3m, 2m, 1m, 0m 前
+
+	recent := cache.getPointsInWindow("5m")
+	band := cache.getPointsInWindow("5m:1m")
+	anchored := cache.getPointsInWindow("now-5m:now-1m")
+
+	if len(recent) != 5 || recent[len(recent)-1].Value != 6 {
+		t.Errorf("Expected '5m' to select [2 3 4 5 6], got %v", recent)
+	}
+	if len(band) != 4 || band[0].Value != 2 || band[len(band)-1].Value != 5 {
+		t.Errorf("Expected '5m:1m' to select [2 3 4 5], got %v", band)
+	}
+	if len(anchored) != len(band) {
+		t.Errorf("Expected 'now-5m:now-1m' to match '5m:1m', got %v", anchored)
+	}
+
+	if ma, err := cache.MA("5m:1m"); err != nil || ma != 3.5 {
+		t.Errorf("Expected MA over band to be 3.5, got %v, %v", ma, err)
+	}
+
+	if _, err := parseWindow("1m:5m"); err == nil {
+		t.Error("Expected error when window start is after end")
+	}
+}
+
+func TestCache_Span(t *testing.T) {
+	cache := NewCache[float64](time.Hour)
+
+	if span, err := cache.Span("10m"); err != nil || span != 0 {
+		t.Errorf("Expected zero span for empty cache, got %v, %v", span, err)
+	}
+
+	fillCache(cache, 30*time.Second, 1, 2, 3)
+	span, err := cache.Span("10m")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if span != time.Minute {
+		t.Errorf("Expected span of 1m, got %v", span)
+	}
+}
+
+func TestCache_Epsilon(t *testing.T) {
+	cache := NewCache[float64](time.Minute)
+	fillCache(cache, time.Second, 1.0, 1.0000001, 1.0)
+
+	// 默认精确比较
+	if !cache.Changed() {
+		t.Error("Expected exact comparison to flag a change")
+	}
+	if count := cache.Count("1m"); count != 3 {
+		t.Errorf("Expected 3 changes with exact comparison, got %d", count)
+	}
+
+	cache.Epsilon = 1e-6
+	if cache.Changed() {
+		t.Error("Expected 1.0000001 vs 1.0 to be unchanged within epsilon")
+	}
+	if count := cache.Count("1m"); count != 1 {
+		t.Errorf("Expected 1 change within epsilon, got %d", count)
+	}
+
+	cache.AddPoint(1.1, nil)
+	if !cache.Changed() {
+		t.Error("Expected change beyond epsilon")
+	}
+}
+
+func TestCache_ExceedsAtThreshold(t *testing.T) {
+	cache := NewCache[float64](time.Minute)
+	fillCache(cache, time.Second, 10, 11)
+
+	// 恰好等于阈值时视为超过，与推送变化检测一致
+	if exceeds, _ := cache.DiffExceeds(1); !exceeds {
+		t.Error("Expected a diff of exactly 1 to reach threshold 1")
+	}
+	if exceeds, _ := cache.PctChangeExceeds(10); !exceeds {
+		t.Error("Expected a change of exactly 10% to reach threshold 10")
+	}
+	if exceeds, _ := cache.DiffExceeds(1.5); exceeds {
+		t.Error("Expected a diff of 1 to stay below threshold 1.5")
+	}
+
+	// 0.3 - 0.1 在浮点下略小于 0.2，Epsilon 吸收该误差
+	jitter := NewCache[float64](time.Minute)
+	fillCache(jitter, time.Second, 0.1, 0.3)
+	if exceeds, _ := jitter.DiffExceeds(0.2); exceeds {
+		t.Error("Expected exact comparison to miss the threshold by floating error")
+	}
+	jitter.Epsilon = 1e-9
+	if exceeds, _ := jitter.DiffExceeds(0.2); !exceeds {
+		t.Error("Expected epsilon to absorb floating error at the threshold")
+	}
+
+	// Epsilon 是数值单位，不放宽百分比阈值
+	pct := NewCache[float64](time.Minute)
+	fillCache(pct, time.Second, 100, 106)
+	pct.Epsilon = 5
+	if exceeds, _ := pct.PctChangeExceeds(10); exceeds {
+		t.Error("Expected a 6% change to stay below threshold 10 regardless of epsilon")
+	}
+}
+
+func TestCache_NonFinite(t *testing.T) {
+	cache := NewCache[float64](time.Minute)
+	fillCache(cache, time.Second, 1, math.NaN(), 3)
+
+	if !cache.HasNonFinite("1m") {
+		t.Error("Expected NaN to be detected")
+	}
+
+	// 默认情况下 NaN 不会静默传播
+	if _, err := cache.MA("1m"); err == nil {
+		t.Error("Expected MA to report the NaN instead of returning NaN")
+	}
+	if _, err := cache.Sum("1m"); err == nil {
+		t.Error("Expected Sum to report the NaN instead of returning NaN")
+	}
+
+	cache.SkipNonFinite = true
+	if ma, err := cache.MA("1m"); err != nil || ma != 2 {
+		t.Errorf("Expected MA 2 with NaN skipped, got %v, %v", ma, err)
+	}
+	if sd, err := cache.StdDev("1m"); err != nil || sd != 1 {
+		t.Errorf("Expected StdDev 1 with NaN skipped, got %v, %v", sd, err)
+	}
+
+	finite := NewCache[float64](time.Minute)
+	fillCache(finite, time.Second, 1, 2)
+	if finite.HasNonFinite("1m") {
+		t.Error("Expected no non-finite values")
+	}
+	infOnly := NewCache[float64](time.Minute)
+	infOnly.SkipNonFinite = true
+	infOnly.AddPoint(math.Inf(1), nil)
+	if _, err := infOnly.MA("1m"); err == nil {
+		t.Error("Expected error when every value is skipped")
+	}
+}
+
+func TestCache_IsWindowFull(t *testing.T) {
+	cache := NewCache[float64](time.Hour)
+
+	if cache.IsWindowFull("1m") {
+		t.Error("Expected empty cache not to cover the window")
+	}
+
+	fillCache(cache, 10*time.Second, 1, 2, 3)
+	if cache.IsWindowFull("1m") {
+		t.Error("Expected 20s of history not to cover a 1m window")
+	}
+	if !cache.IsWindowFull("15s") {
+		t.Error("Expected 20s of history to cover a 15s window")
+	}
+
+	old := time.Now().Add(-2 * time.Minute)
+	cache.AddPoint(0, &old)
+	if !cache.IsWindowFull("1m") {
+		t.Error("Expected window to be full once older history exists")
+	}
+}
+
+func TestCache_TimeSinceChange(t *testing.T) {
+	cache := NewCache[float64](time.Hour)
+	if _, err := cache.TimeSinceChange(); err == nil {
+		t.Error("Expected error for empty cache")
+	}
+
+	// 所有值相同时返回 0
+	fillCache(cache, time.Minute, 5, 5, 5)
+	if d, err := cache.TimeSinceChange(); err != nil || d != 0 {
+		t.Errorf("Expected 0 for unchanged values, got %v (err: %v)", d, err)
+	}
+
+	// 值在 20 分钟前从 1 变为 2
+	changing := NewCache[float64](time.Hour)
+	fillCache(changing, 10*time.Minute, 1, 1, 2, 2, 2)
+	d, err := changing.TimeSinceChange()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if d < 20*time.Minute || d > 21*time.Minute {
+		t.Errorf("Expected about 20m since change, got %v", d)
+	}
+
+	strCache := NewCache[string](time.Hour)
+	fillCache(strCache, time.Minute, "Run", "Idle")
+	if d, err := strCache.TimeSinceChange(); err != nil || d > time.Second {
+		t.Errorf("Expected a fresh change for string cache, got %v (err: %v)", d, err)
+	}
+}
+
+func TestCache_DistinctValues(t *testing.T) {
+	boolCache := NewCache[bool](time.Minute)
+	fillCache(boolCache, time.Second, true, false, true, false)
+	values, err := boolCache.DistinctValues("1m")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(values) != 2 || values[0] != true || values[1] != false {
+		t.Errorf("Expected [true false], got %v", values)
+	}
+
+	// 按首次出现顺序返回
+	strCache := NewCache[string](time.Minute)
+	fillCache(strCache, time.Second, "Idle", "Run", "Fault", "Idle", "Run")
+	states, err := strCache.DistinctValues("1m")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"Idle", "Run", "Fault"}
+	if len(states) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, states)
+	}
+	for i := range expected {
+		if states[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, states)
+		}
+	}
+
+	byteCache := NewCache[[]byte](time.Minute)
+	fillCache(byteCache, time.Second, []byte{1, 2}, []byte{1, 2}, []byte{3})
+	if raw, _ := byteCache.DistinctValues("1m"); len(raw) != 2 {
+		t.Errorf("Expected 2 distinct byte values, got %v", raw)
+	}
+
+	empty := NewCache[float64](time.Minute)
+	if values, err := empty.DistinctValues("1m"); err != nil || values == nil || len(values) != 0 {
+		t.Errorf("Expected empty slice for empty window, got %v (err: %v)", values, err)
+	}
+	if _, err := empty.DistinctValues("bad"); err == nil {
+		t.Error("Expected error for invalid window")
+	}
+}
+
+func TestCache_ToCSV(t *testing.T) {
+	cache := NewCache[float64](time.Minute)
+	ts1 := time.Now().Add(-2 * time.Second).UTC().Truncate(time.Second)
+	ts2 := ts1.Add(time.Second)
+	cache.AddPoint(1.5, &ts1)
+	cache.AddPoint(20, &ts2)
+
+	var buf bytes.Buffer
+	if err := cache.ToCSV(&buf); err != nil {
+		t.Fatalf("ToCSV failed: %v", err)
+	}
+	expected := "timestamp,value\n" +
+		ts1.Format(time.RFC3339Nano) + ",1.5\n" +
+		ts2.Format(time.RFC3339Nano) + ",20\n"
+	if buf.String() != expected {
+		t.Errorf("Expected CSV:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	// []byte 以十六进制输出
+	byteCache := NewCache[[]byte](time.Minute)
+	byteCache.AddPoint([]byte{0x0A, 0xFF}, &ts1)
+	buf.Reset()
+	if err := byteCache.ToCSV(&buf); err != nil {
+		t.Fatalf("ToCSV failed: %v", err)
+	}
+	if !strings.HasSuffix(buf.String(), ",0aff\n") {
+		t.Errorf("Expected hex value, got %q", buf.String())
+	}
+}
+
+func TestCache_AtIndex(t *testing.T) {
+	cache := NewCache[float64](time.Minute)
+	fillCache(cache, time.Second, 1, 2, 3)
+
+	cases := []struct {
+		index    int
+		expected float64
+		ok       bool
+	}{
+		{-1, 3, true},
+		{-2, 2, true},
+		{-3, 1, true},
+		{0, 1, true},
+		{2, 3, true},
+		// 越界
+		{-4, 0, false},
+		{3, 0, false},
+	}
+	for _, c := range cases {
+		point, ok := cache.AtIndex(c.index)
+		if ok != c.ok || point.Value != c.expected {
+			t.Errorf("AtIndex(%d): expected %v/%v, got %v/%v", c.index, c.expected, c.ok, point.Value, ok)
+		}
+	}
+
+	if _, ok := NewCache[bool](time.Minute).AtIndex(-1); ok {
+		t.Error("Expected false for empty cache")
+	}
+}
+
+func TestCache_SampleCount(t *testing.T) {
+	cache := NewCache[float64](time.Minute)
+	fillCache(cache, time.Second, 5, 5, 5, 6)
+
+	// Count 只统计变化次数，SampleCount 统计所有点
+	if got := cache.Count("1m"); got != 2 {
+		t.Errorf("Expected Count 2, got %d", got)
+	}
+	if got := cache.SampleCount("1m"); got != 4 {
+		t.Errorf("Expected SampleCount 4, got %d", got)
+	}
+	if got := cache.SampleCount("1500ms"); got != 2 {
+		t.Errorf("Expected SampleCount 2 in 1.5s window, got %d", got)
+	}
+	if got := NewCache[bool](time.Minute).SampleCount("1m"); got != 0 {
+		t.Errorf("Expected SampleCount 0 for empty cache, got %d", got)
+	}
+}
+
+func TestCache_WordAt(t *testing.T) {
+	cache := NewCache[[]byte](time.Minute)
+	cache.AddPoint([]byte{0x01, 0x02, 0x03, 0x04, 0xAB, 0xCD}, nil)
+
+	// Modbus 寄存器默认大端
+	if w, err := cache.WordAt(0, false); err != nil || w != 0x0102 {
+		t.Errorf("Expected register 0 = 0x0102, got %#x (err: %v)", w, err)
+	}
+	if w, err := cache.WordAt(2, false); err != nil || w != 0xABCD {
+		t.Errorf("Expected register 2 = 0xABCD, got %#x (err: %v)", w, err)
+	}
+	if w, err := cache.WordAt(2, true); err != nil || w != 0xCDAB {
+		t.Errorf("Expected little-endian register 2 = 0xCDAB, got %#x (err: %v)", w, err)
+	}
+	if _, err := cache.WordAt(3, false); err == nil {
+		t.Error("Expected error for out-of-range register")
+	}
+	if _, err := cache.WordAt(-1, false); err == nil {
+		t.Error("Expected error for negative register")
+	}
+
+	floatCache := NewCache[float64](time.Minute)
+	floatCache.AddPoint(1, nil)
+	if _, err := floatCache.WordAt(0, false); err == nil {
+		t.Error("Expected error for non-[]byte cache")
+	}
+}
+
+func TestCache_Mode(t *testing.T) {
+	cache := NewCache[string](time.Minute)
+	fillCache(cache, time.Second, "Idle", "Run", "Fault", "Run", "Idle", "Run")
+
+	mode, err := cache.Mode("1m")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if mode != "Run" {
+		t.Errorf("Expected Run, got %s", mode)
+	}
+
+	// 次数相同时取最近出现的值
+	tie := NewCache[bool](time.Minute)
+	fillCache(tie, time.Second, true, false, false, true)
+	if mode, err := tie.Mode("1m"); err != nil || mode != true {
+		t.Errorf("Expected true on tie, got %v (err: %v)", mode, err)
+	}
+
+	if _, err := NewCache[float64](time.Minute).Mode("1m"); err == nil {
+		t.Error("Expected error for empty window")
+	}
+}
+
+func TestCache_IsFlapping(t *testing.T) {
+	cache := NewCache[bool](time.Minute)
+	// 11 个点，切换 10 次
+	values := make([]bool, 11)
+	for i := range values {
+		values[i] = i%2 == 0
+	}
+	fillCache(cache, time.Second, values...)
+
+	if flapping, err := cache.IsFlapping("1m", 5); err != nil || !flapping {
+		t.Errorf("Expected flapping with 10 transitions over 5, got %v (err: %v)", flapping, err)
+	}
+	if flapping, err := cache.IsFlapping("1m", 10); err != nil || flapping {
+		t.Errorf("Expected no flapping with 10 transitions at limit 10, got %v (err: %v)", flapping, err)
+	}
+	if flapping, _ := NewCache[bool](time.Minute).IsFlapping("1m", 0); flapping {
+		t.Error("Expected empty cache not to flap")
+	}
+	if _, err := cache.IsFlapping("bad", 5); err == nil {
+		t.Error("Expected error for invalid window")
+	}
+}
+
+func TestCache_ArgMaxArgMin(t *testing.T) {
+	cache := NewCache[float64](time.Minute)
+	now := fillCache(cache, time.Second, 3, 9, 1, 5)
+
+	max, ts, err := cache.ArgMax("1m")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// 最大值 9 位于倒数第三个点
+	if max != 9 || ts == nil || !ts.Equal(now.Add(-2*time.Second)) {
+		t.Errorf("Expected max 9 at %v, got %v at %v", now.Add(-2*time.Second), max, ts)
+	}
+
+	min, ts, err := cache.ArgMin("1m")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if min != 1 || ts == nil || !ts.Equal(now.Add(-time.Second)) {
+		t.Errorf("Expected min 1 at %v, got %v at %v", now.Add(-time.Second), min, ts)
+	}
+
+	empty := NewCache[float64](time.Minute)
+	if v, ts, err := empty.ArgMax("1m"); err != nil || v != 0 || ts != nil {
+		t.Errorf("Expected 0/nil for empty window, got %v/%v (err: %v)", v, ts, err)
+	}
+
+	if _, _, err := NewCache[string](time.Minute).ArgMin("1m"); err == nil {
+		t.Error("Expected error for non-numeric cache")
+	}
+}
+
+func TestCache_LazyExpiration(t *testing.T) {
+	for _, lazy := range []bool{false, true} {
+		cache := NewCache[float64](time.Minute)
+		cache.LazyExpiration = lazy
+
+		now := time.Now()
+		// 乱序写入，包含已过期的点
+		offsets := []time.Duration{-10 * time.Second, -2 * time.Minute, -5 * time.Second, -90 * time.Second, -1 * time.Second, -3 * time.Minute}
+		for i, offset := range offsets {
+			ts := now.Add(offset)
+			cache.AddPoint(float64(i), &ts)
+		}
+
+		points := cache.getPointsInWindow("1h")
+		if len(points) != 3 {
+			t.Errorf("lazy=%v: expected 3 unexpired points, got %d", lazy, len(points))
+		}
+		for _, point := range points {
+			if time.Since(*point.Timestamp) > time.Minute {
+				t.Errorf("lazy=%v: expired point %v appeared in query results", lazy, point.Timestamp)
+			}
+		}
+	}
+}
+
+func TestCache_LazyExpirationCompress(t *testing.T) {
+	cache := NewCache[float64](time.Minute)
+	cache.LazyExpiration = true
+	cache.Compress = true
+
+	now := time.Now()
+	at := func(offset time.Duration) *time.Time {
+		ts := now.Add(offset)
+		return &ts
+	}
+	cache.AddPoint(0, at(-55*time.Second))
+	cache.AddPoint(1, at(-50*time.Second))
+	cache.AddPoint(1, at(-30*time.Second))
+
+	// 缩短过期时间使区间起点过期，区间结束仍在有效期内
+	cache.ExpireDuration = 40 * time.Second
+	cache.AddPoint(1, at(-5*time.Second))
+
+	// 过期基准按区间结束时间记录，后续写入无需每次全量扫描
+	if len(cache.Points) != 1 {
+		t.Fatalf("Expected only the active run to remain, got %d points", len(cache.Points))
+	}
+	if !cache.oldest.Equal(*at(-5 * time.Second)) {
+		t.Errorf("Expected expiry bound at the run end, got %v", cache.oldest)
+	}
+
+	// 区间结束后起点按自身时间过期
+	cache.AddPoint(2, at(-time.Second))
+	if len(cache.Points) != 1 || cache.Points[0].Value != 2 {
+		t.Errorf("Expected the closed run to expire by its start, got %+v", cache.Points)
+	}
+}
+
+func BenchmarkCache_AddPoint(b *testing.B) {
+	for _, lazy := range []bool{false, true} {
+		name := "Eager"
+		if lazy {
+			name = "Lazy"
+		}
+		b.Run(name, func(b *testing.B) {
+			cache := NewCache[float64](time.Hour)
+			cache.LazyExpiration = lazy
+			start := time.Now().Add(-30 * time.Minute)
+			for i := 0; i < 1000; i++ {
+				ts := start.Add(time.Duration(i) * time.Second)
+				cache.AddPoint(float64(i), &ts)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ts := start.Add(time.Duration(1000+i) * time.Second)
+				cache.AddPoint(float64(i), &ts)
+			}
+		})
+	}
+}
+
+func TestCache_ValueAt(t *testing.T) {
+	cache := NewCache[float64](time.Minute)
+	now := fillCache(cache, 10*time.Second, 1, 2, 3)
+
+	if v, ok := cache.ValueAt(now.Add(-15 * time.Second)); !ok || v != 1 {
+		t.Errorf("Expected 1 in effect 15s ago, got %v (ok: %v)", v, ok)
+	}
+	if v, ok := cache.ValueAt(now); !ok || v != 3 {
+		t.Errorf("Expected 3 at now, got %v (ok: %v)", v, ok)
+	}
+	if _, ok := cache.ValueAt(now.Add(-time.Minute)); ok {
+		t.Error("Expected no value before the first point")
+	}
+}
+
+func TestCorrelation(t *testing.T) {
+	// 使用相同的基准时间写入，保证采样时间对齐
+	now := time.Now()
+	fill := func(interval time.Duration, values ...float64) *Cache[float64] {
+		c := NewCache[float64](time.Minute)
+		for i, v := range values {
+			ts := now.Add(-time.Duration(len(values)-1-i) * interval)
+			c.AddPoint(v, &ts)
+		}
+		return c
+	}
+	a := fill(time.Second, 1, 2, 3, 4, 5, 6)
+	b := fill(time.Second, 12, 14, 16, 18, 20, 22)
+	c := fill(time.Second, 1, -1, -1, -1, -1, 1)
+
+	// 完全线性相关
+	if r, err := Correlation(a, b, "1m"); err != nil || math.Abs(r-1) > 1e-9 {
+		t.Errorf("Expected correlation 1, got %v (err: %v)", r, err)
+	}
+	// 不相关
+	if r, err := Correlation(a, c, "1m"); err != nil || math.Abs(r) > 1e-9 {
+		t.Errorf("Expected correlation 0, got %v (err: %v)", r, err)
+	}
+
+	// 采样时间不同的信号按时间对齐
+	sparse := fill(2*time.Second, 2, 4, 6)
+	if r, err := Correlation(a, sparse, "1m"); err != nil || r <= 0.8 {
+		t.Errorf("Expected strong positive correlation for aligned signals, got %v (err: %v)", r, err)
+	}
+
+	few := fill(time.Second, 1, 2)
+	if _, err := Correlation(few, b, "1m"); err == nil {
+		t.Error("Expected error for too few points")
+	}
+	if _, err := Correlation(a, b, "bad"); err == nil {
+		t.Error("Expected error for invalid window")
+	}
+}
+
+func TestCache_Compress(t *testing.T) {
+	cache := NewCache[float64](time.Hour)
+	cache.Compress = true
+
+	base := time.Now().Add(-200 * time.Second)
+	for i := 0; i < 100; i++ {
+		ts := base.Add(time.Duration(i) * time.Second)
+		cache.AddPoint(5.0, &ts)
+	}
+
+	if cache.Len() != 1 {
+		t.Fatalf("Expected 1 stored point, got %d", cache.Len())
+	}
+	if n := cache.SampleCount("10m"); n != 1 {
+		t.Errorf("Expected SampleCount 1, got %d", n)
+	}
+	// 存储的点保留区间起始时间，Timestamp 返回最后一次写入的时间
+	if p := cache.Point(); p == nil || !p.Timestamp.Equal(base) {
+		t.Errorf("Expected stored point at run start %v, got %v", base, p)
+	}
+	last := base.Add(99 * time.Second)
+	if ts := cache.Timestamp(); ts == nil || !ts.Equal(last) {
+		t.Errorf("Expected latest timestamp %v, got %v", last, ts)
+	}
+
+	// 新值结束区间并追加
+	next := base.Add(150 * time.Second)
+	cache.AddPoint(10.0, &next)
+	if cache.Len() != 2 {
+		t.Fatalf("Expected 2 stored points, got %d", cache.Len())
+	}
+	if ts := cache.Timestamp(); ts == nil || !ts.Equal(next) {
+		t.Errorf("Expected latest timestamp %v, got %v", next, ts)
+	}
+
+	// 时间加权平均按区间长度计算，与未压缩时一致
+	plain := NewCache[float64](time.Hour)
+	for i := 0; i < 100; i++ {
+		ts := base.Add(time.Duration(i) * time.Second)
+		plain.AddPoint(5.0, &ts)
+	}
+	plain.AddPoint(10.0, &next)
+	compressed, _ := cache.TWA("10m")
+	expected, _ := plain.TWA("10m")
+	if math.Abs(compressed-expected) > 0.01 {
+		t.Errorf("Expected TWA %v, got %v", expected, compressed)
+	}
+}
+
+func TestCache_CompressKeepsActiveRun(t *testing.T) {
+	cache := NewCache[float64](time.Minute)
+	cache.Compress = true
+
+	old := time.Now().Add(-5 * time.Minute)
+	cache.AddPoint(1.0, &old)
+	start := time.Now().Add(-2 * time.Minute)
+	cache.AddPoint(2.0, &start)
+	// 区间起点已超出缓存时长，但区间仍在持续
+	recent := time.Now().Add(-time.Second)
+	cache.AddPoint(2.0, &recent)
+
+	if cache.Len() != 1 || cache.Value() != 2.0 {
+		t.Errorf("Expected the active run to be kept, got %v", cache.Points)
+	}
+	if stale, _ := cache.IsStale("30s"); stale {
+		t.Error("Expected a compressed run written recently not to be stale")
+	}
+}
+
+func TestCache_CompressChangeDetection(t *testing.T) {
+	compressed := NewCache[float64](time.Hour)
+	compressed.Compress = true
+	plain := NewCache[float64](time.Hour)
+	values := []float64{1, 1, 1, 1, 1, 9, 9, 9}
+	fillCache(compressed, time.Second, values...)
+	fillCache(plain, time.Second, values...)
+
+	// 区间内的重复值视为最新值的重复，与未压缩时一致
+	if compressed.Changed() != plain.Changed() || compressed.Changed() {
+		t.Errorf("Expected Changed false like the plain cache, got %v", compressed.Changed())
+	}
+	if exceeds, err := compressed.DiffExceeds(1); err != nil || exceeds {
+		t.Errorf("Expected DiffExceeds false within a run, got %v (err: %v)", exceeds, err)
+	}
+	if exceeds, err := compressed.PctChangeExceeds(10); err != nil || exceeds {
+		t.Errorf("Expected PctChangeExceeds false within a run, got %v (err: %v)", exceeds, err)
+	}
+	if rate, err := compressed.Rate(); err != nil || rate != 0 {
+		t.Errorf("Expected Rate 0 within a run, got %v (err: %v)", rate, err)
+	}
+
+	// 迟到的重复值不回退区间结束时间
+	last := compressed.Timestamp()
+	late := last.Add(-1500 * time.Millisecond)
+	compressed.AddPoint(9, &late)
+	if ts := compressed.Timestamp(); ts == nil || !ts.Equal(*last) {
+		t.Errorf("Expected run end to stay at %v, got %v", last, ts)
+	}
+	if compressed.Len() != 2 {
+		t.Errorf("Expected the late duplicate to be absorbed, got %d points", compressed.Len())
+	}
+}
+
+func TestCache_AvgInterval(t *testing.T) {
+	cache := NewCache[float64](time.Hour)
+	if d, err := cache.AvgInterval("10m"); err != nil || d != 0 {
+		t.Errorf("Expected 0 for empty cache, got %v (err: %v)", d, err)
+	}
+
+	// 间隔分别为 1s、2s、4s
+	base := time.Now().Add(-time.Minute)
+	for _, offset := range []int{0, 1, 3, 7} {
+		ts := base.Add(time.Duration(offset) * time.Second)
+		cache.AddPoint(float64(offset), &ts)
+	}
+	d, err := cache.AvgInterval("10m")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := 7 * time.Second / 3
+	if d != expected {
+		t.Errorf("Expected %v, got %v", expected, d)
+	}
+
+	if _, err := cache.AvgInterval("abc"); err == nil {
+		t.Error("Expected error for invalid window")
+	}
+}
+
+func TestCache_ChangedBits(t *testing.T) {
+	cache := NewCache[[]byte](time.Hour)
+	cache.AddPoint([]byte{0b00000101, 0x00}, nil)
+	if _, err := cache.ChangedBits(); err == nil {
+		t.Error("Expected error with a single point")
+	}
+
+	ts := time.Now().Add(time.Millisecond)
+	cache.AddPoint([]byte{0b00000110, 0b10000000}, &ts)
+	bits, err := cache.ChangedBits()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []int{0, 1, 15}
+	if len(bits) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, bits)
+	}
+	for i := range expected {
+		if bits[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, bits)
+			break
+		}
+	}
+
+	ts = ts.Add(time.Millisecond)
+	cache.AddPoint([]byte{0x00}, &ts)
+	if _, err := cache.ChangedBits(); err == nil {
+		t.Error("Expected error for differing lengths")
+	}
+
+	floats := NewCache[float64](time.Hour)
+	floats.AddPoint(1, nil)
+	ts = time.Now().Add(time.Millisecond)
+	floats.AddPoint(2, &ts)
+	if _, err := floats.ChangedBits(); err == nil {
+		t.Error("Expected error for non-byte cache")
+	}
+}
+
+func TestCache_OnTime(t *testing.T) {
+	cache := NewCache[bool](time.Hour)
+
+	// 方波：每 10 秒切换一次，最后一个点距现在 10 秒
+	base := time.Now().Add(-60 * time.Second)
+	for i := 0; i < 6; i++ {
+		ts := base.Add(time.Duration(i) * 10 * time.Second)
+		cache.AddPoint(i%2 == 0, &ts)
+	}
+	onTime, err := cache.OnTime("10m")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// 第 0、2、4 个点为 true，各持续 10 秒
+	if onTime < 30*time.Second || onTime > 31*time.Second {
+		t.Errorf("Expected about 30s, got %v", onTime)
+	}
+
+	floats := NewCache[float64](time.Hour)
+	if _, err := floats.OnTime("10m"); err == nil {
+		t.Error("Expected error for non-bool cache")
+	}
+}
+
+func TestCache_Nearest(t *testing.T) {
+	cache := NewCache[float64](time.Hour)
+	if _, _, ok := cache.Nearest(time.Now()); ok {
+		t.Error("Expected false for empty cache")
+	}
+
+	base := time.Now().Add(-time.Minute)
+	for i, offset := range []int{0, 10, 20} {
+		ts := base.Add(time.Duration(offset) * time.Second)
+		cache.AddPoint(float64(i+1), &ts)
+	}
+
+	tests := []struct {
+		offset   time.Duration
+		expected float64
+	}{
+		{8 * time.Second, 2},  // 最近的点在目标之后
+		{3 * time.Second, 1},  // 最近的点在目标之前
+		{5 * time.Second, 1},  // 距离相同时取较早的点
+		{-time.Second, 1},     // 早于所有点
+		{time.Minute, 3},      // 晚于所有点
+		{20 * time.Second, 3}, // 恰好命中
+	}
+	for _, tt := range tests {
+		value, ts, ok := cache.Nearest(base.Add(tt.offset))
+		if !ok || value != tt.expected || ts == nil {
+			t.Errorf("Nearest(+%v): expected %v, got %v (ok %v)", tt.offset, tt.expected, value, ok)
+		}
+	}
+
+	// ValueAt 只向前查找
+	if v, _ := cache.ValueAt(base.Add(8 * time.Second)); v != 1 {
+		t.Errorf("Expected ValueAt to look backward only, got %v", v)
+	}
+}
+
+func TestCache_NearestOutOfOrder(t *testing.T) {
+	cache := NewCache[float64](time.Hour)
+	base := time.Now().Add(-time.Minute)
+	// 乱序写入：t0, t10, t5
+	for _, offset := range []int{0, 10, 5} {
+		ts := base.Add(time.Duration(offset) * time.Second)
+		cache.AddPoint(float64(offset), &ts)
+	}
+
+	if value, ts, ok := cache.Nearest(base.Add(5 * time.Second)); !ok || value != 5 || !ts.Equal(base.Add(5*time.Second)) {
+		t.Errorf("Expected the exact t5 point, got %v at %v (ok %v)", value, ts, ok)
+	}
+	if value, _, _ := cache.Nearest(base.Add(7 * time.Second)); value != 5 {
+		t.Errorf("Expected t5 nearest to t7, got %v", value)
+	}
+	if value, _, _ := cache.Nearest(base.Add(9 * time.Second)); value != 10 {
+		t.Errorf("Expected t10 nearest to t9, got %v", value)
+	}
+}
+
+func TestInterpolateAt(t *testing.T) {
+	cache := NewCache[float64](time.Hour)
+	base := time.Now().Add(-time.Minute)
+	first, second := base, base.Add(10*time.Second)
+	cache.AddPoint(10, &first)
+	cache.AddPoint(20, &second)
+
+	if v, ok := InterpolateAt(cache, base.Add(5*time.Second)); !ok || v != 15 {
+		t.Errorf("Expected midpoint 15, got %v (ok %v)", v, ok)
+	}
+	if v, ok := InterpolateAt(cache, base.Add(2*time.Second)); !ok || math.Abs(v-12) > 1e-9 {
+		t.Errorf("Expected 12, got %v (ok %v)", v, ok)
+	}
+	if v, ok := InterpolateAt(cache, second); !ok || v != 20 {
+		t.Errorf("Expected exact point 20, got %v (ok %v)", v, ok)
+	}
+	if _, ok := InterpolateAt(cache, base.Add(-time.Second)); ok {
+		t.Error("Expected false before the cached range")
+	}
+	if _, ok := InterpolateAt(cache, base.Add(11*time.Second)); ok {
+		t.Error("Expected false after the cached range")
+	}
+
+	// 乱序写入 t0, t10, t5 时仍使用 t5 作为区间端点
+	unordered := NewCache[float64](time.Hour)
+	for _, p := range []struct{ offset, value float64 }{{0, 0}, {10, 10}, {5, 4}} {
+		ts := base.Add(time.Duration(p.offset) * time.Second)
+		unordered.AddPoint(p.value, &ts)
+	}
+	if v, ok := InterpolateAt(unordered, base.Add(6*time.Second)); !ok || math.Abs(v-5.2) > 1e-9 {
+		t.Errorf("Expected 5.2 between t5 and t10, got %v (ok %v)", v, ok)
+	}
+	if v, ok := InterpolateAt(unordered, base.Add(5*time.Second)); !ok || v != 4 {
+		t.Errorf("Expected exact t5 point 4, got %v (ok %v)", v, ok)
+	}
+}
+
+func TestCache_RejectOutOfOrder(t *testing.T) {
+	base := time.Now().Add(-time.Minute)
+	newer, older := base.Add(10*time.Second), base
+
+	// 默认允许乱序插入
+	cache := NewCache[float64](time.Hour)
+	cache.AddPoint(1, &newer)
+	cache.AddPoint(2, &older)
+	if cache.Len() != 2 {
+		t.Errorf("Expected out-of-order point to be kept by default, got %d points", cache.Len())
+	}
+
+	cache = NewCache[float64](time.Hour)
+	cache.RejectOutOfOrder = true
+	cache.AddPoint(1, &newer)
+	cache.AddPoint(2, &older)
+	if cache.Len() != 1 || cache.Value() != 1 {
+		t.Errorf("Expected older point to be rejected, got %v", cache.Points)
+	}
+
+	// 相同时间戳仍然更新值
+	cache.AddPoint(3, &newer)
+	if cache.Len() != 1 || cache.Value() != 3 {
+		t.Errorf("Expected same timestamp to update the value, got %v", cache.Points)
+	}
+
+	// 批量插入同样丢弃
+	cache.AddPoints([]Point[float64]{{Value: 4, Timestamp: &older}})
+	if cache.Len() != 1 {
+		t.Errorf("Expected older batch point to be rejected, got %d points", cache.Len())
+	}
+}
+
+func TestCache_Summary(t *testing.T) {
+	cache := NewCache[float64](time.Hour)
+	if stats, err := cache.Summary("10m"); err != nil || stats != (WindowStats{}) {
+		t.Errorf("Expected zeroed stats for empty window, got %+v (err: %v)", stats, err)
+	}
+
+	fillCache(cache, time.Second, 4, 8, 15, 16, 23, 42)
+	stats, err := cache.Summary("10m")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ma, _ := cache.MA("10m")
+	minVal, _ := cache.Min("10m")
+	maxVal, _ := cache.Max("10m")
+	stdDev, _ := cache.StdDev("10m")
+	sum, _ := cache.Sum("10m")
+	count := cache.SampleCount("10m")
+
+	const eps = 1e-9
+	if math.Abs(stats.Mean-ma) > eps || stats.Min != minVal || stats.Max != maxVal ||
+		math.Abs(stats.StdDev-stdDev) > eps || math.Abs(stats.Sum-sum) > eps || stats.Count != count {
+		t.Errorf("Expected {Mean:%v Min:%v Max:%v StdDev:%v Sum:%v Count:%d}, got %+v", ma, minVal, maxVal, stdDev, sum, count, stats)
+	}
+
+	labels := NewCache[string](time.Hour)
+	if _, err := labels.Summary("10m"); err == nil {
+		t.Error("Expected type error for string cache")
+	}
+}
+
+func TestCache_IsFlatlined(t *testing.T) {
+	stuck := NewCache[float64](time.Hour)
+	if flat, err := stuck.IsFlatlined("10m"); err != nil || flat {
+		t.Errorf("Expected empty window not to be flatlined, got %v (err: %v)", flat, err)
+	}
+	fillCache(stuck, time.Second, 21.5)
+	if flat, _ := stuck.IsFlatlined("10m"); flat {
+		t.Error("Expected single sample not to be flatlined")
+	}
+
+	stuck = NewCache[float64](time.Hour)
+	values := make([]float64, 50)
+	for i := range values {
+		values[i] = 21.5
+	}
+	fillCache(stuck, time.Second, values...)
+	if flat, err := stuck.IsFlatlined("10m"); err != nil || !flat {
+		t.Errorf("Expected identical samples to be flatlined, got %v (err: %v)", flat, err)
+	}
+
+	varying := NewCache[float64](time.Hour)
+	fillCache(varying, time.Second, 21.5, 21.6, 21.5, 21.7)
+	if flat, _ := varying.IsFlatlined("10m"); flat {
+		t.Error("Expected varying signal not to be flatlined")
+	}
+
+	// 压缩模式下重复值合并为一个点
+	compressed := NewCache[float64](time.Hour)
+	compressed.Compress = true
+	fillCache(compressed, time.Second, values...)
+	if flat, _ := compressed.IsFlatlined("10m"); compressed.Len() != 1 || !flat {
+		t.Errorf("Expected compressed run to be flatlined, got %v with %d points", flat, compressed.Len())
+	}
+
+	if _, err := stuck.IsFlatlined("abc"); err == nil {
+		t.Error("Expected error for invalid window")
+	}
+}
@@ -8,6 +8,17 @@ type PushValue struct {
 	Key       string     `json:"key" mapstructure:"key"`
 	Value     any        `json:"value" mapstructure:"value"`
 	Timestamp *time.Time `json:"timestamp,omitempty" mapstructure:"timestamp"`
+	DataType  string     `json:"data_type,omitempty" mapstructure:"data_type"` // Optional declared data type of the variable, set by GetPushValues
+	Unit      string     `json:"unit,omitempty" mapstructure:"unit"`           // Optional engineering unit of the variable, set by GetPushValues
+}
+
+// NewPushValue creates a PushValue for key from a cache point
+func NewPushValue[T float64 | bool | string | []byte](key string, p Point[T]) *PushValue {
+	return &PushValue{
+		Key:       key,
+		Value:     p.Value,
+		Timestamp: p.Timestamp,
+	}
 }
 
 type Command struct {
@@ -24,3 +35,13 @@ type CommandResponse struct {
 	Payload   map[string]any `json:"payload,omitempty" mapstructure:"payload"`
 	Timestamp *time.Time     `json:"timestamp,omitempty" mapstructure:"timestamp"`
 }
+
+// TriggeredEvent is an event raised by the edge, e.g. when a variable alarm limit is crossed
+type TriggeredEvent struct {
+	Key       string     `json:"key" mapstructure:"key"`
+	Category  string     `json:"category,omitempty" mapstructure:"category"`
+	Level     int        `json:"level,omitempty" mapstructure:"level"`
+	Message   string     `json:"message,omitempty" mapstructure:"message"`
+	Value     any        `json:"value" mapstructure:"value"`
+	Timestamp *time.Time `json:"timestamp,omitempty" mapstructure:"timestamp"`
+}
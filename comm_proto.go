@@ -0,0 +1,398 @@
+package edgeexpr
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// The comm types encode to the protobuf wire format of the following schema, so the uplink can
+// decode them with code generated from it:
+//
+//	message Value {
+//	  oneof kind {
+//	    double float_value = 1;
+//	    bool bool_value = 2;
+//	    string string_value = 3;
+//	    bytes bytes_value = 4;
+//	    sint64 int_value = 5;
+//	  }
+//	}
+//	message PushValue {
+//	  string key = 1;
+//	  Value value = 2;
+//	  google.protobuf.Timestamp timestamp = 3;
+//	  string data_type = 4;
+//	  string unit = 5;
+//	}
+//	message Command {
+//	  string command_id = 1;
+//	  string command = 2;
+//	  map<string, Value> payload = 3;
+//	  google.protobuf.Timestamp timestamp = 4;
+//	}
+//	message CommandResponse {
+//	  string command_id = 1;
+//	  string message = 2;
+//	  bool success = 3;
+//	  map<string, Value> payload = 4;
+//	  google.protobuf.Timestamp timestamp = 5;
+//	}
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Marshal encodes the push value in protobuf wire format
+func (p *PushValue) Marshal() ([]byte, error) {
+	var buf []byte
+	buf = appendProtoString(buf, 1, p.Key)
+	if p.Value != nil {
+		value, err := marshalProtoValue(p.Value)
+		if err != nil {
+			return nil, fmt.Errorf("push value %s: %v", p.Key, err)
+		}
+		buf = appendProtoBytes(buf, 2, value)
+	}
+	buf = appendProtoTimestamp(buf, 3, p.Timestamp)
+	buf = appendProtoString(buf, 4, p.DataType)
+	buf = appendProtoString(buf, 5, p.Unit)
+	return buf, nil
+}
+
+// Unmarshal decodes a push value from protobuf wire format
+func (p *PushValue) Unmarshal(data []byte) error {
+	*p = PushValue{}
+	return walkProto(data, func(field int, wire int, num uint64, b []byte) error {
+		var err error
+		switch field {
+		case 1:
+			p.Key = string(b)
+		case 2:
+			p.Value, err = unmarshalProtoValue(b)
+		case 3:
+			p.Timestamp, err = unmarshalProtoTimestamp(b)
+		case 4:
+			p.DataType = string(b)
+		case 5:
+			p.Unit = string(b)
+		}
+		return err
+	})
+}
+
+// Marshal encodes the command in protobuf wire format
+func (c *Command) Marshal() ([]byte, error) {
+	var buf []byte
+	buf = appendProtoString(buf, 1, c.CommandID)
+	buf = appendProtoString(buf, 2, c.Command)
+	buf, err := appendProtoPayload(buf, 3, c.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("command %s: %v", c.CommandID, err)
+	}
+	buf = appendProtoTimestamp(buf, 4, c.Timestamp)
+	return buf, nil
+}
+
+// Unmarshal decodes a command from protobuf wire format
+func (c *Command) Unmarshal(data []byte) error {
+	*c = Command{}
+	return walkProto(data, func(field int, wire int, num uint64, b []byte) error {
+		var err error
+		switch field {
+		case 1:
+			c.CommandID = string(b)
+		case 2:
+			c.Command = string(b)
+		case 3:
+			c.Payload, err = unmarshalProtoPayloadEntry(c.Payload, b)
+		case 4:
+			c.Timestamp, err = unmarshalProtoTimestamp(b)
+		}
+		return err
+	})
+}
+
+// Marshal encodes the command response in protobuf wire format
+func (r *CommandResponse) Marshal() ([]byte, error) {
+	var buf []byte
+	buf = appendProtoString(buf, 1, r.CommandID)
+	buf = appendProtoString(buf, 2, r.Message)
+	if r.Success {
+		buf = appendProtoVarint(buf, 3, 1)
+	}
+	buf, err := appendProtoPayload(buf, 4, r.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("command response %s: %v", r.CommandID, err)
+	}
+	buf = appendProtoTimestamp(buf, 5, r.Timestamp)
+	return buf, nil
+}
+
+// Unmarshal decodes a command response from protobuf wire format
+func (r *CommandResponse) Unmarshal(data []byte) error {
+	*r = CommandResponse{}
+	return walkProto(data, func(field int, wire int, num uint64, b []byte) error {
+		var err error
+		switch field {
+		case 1:
+			r.CommandID = string(b)
+		case 2:
+			r.Message = string(b)
+		case 3:
+			r.Success = num != 0
+		case 4:
+			r.Payload, err = unmarshalProtoPayloadEntry(r.Payload, b)
+		case 5:
+			r.Timestamp, err = unmarshalProtoTimestamp(b)
+		}
+		return err
+	})
+}
+
+// marshalProtoValue encodes value as a Value message according to its concrete type
+func marshalProtoValue(value any) ([]byte, error) {
+	var buf []byte
+	switch v := value.(type) {
+	case float64:
+		buf = appendProtoDouble(buf, 1, v)
+	case float32:
+		buf = appendProtoDouble(buf, 1, float64(v))
+	case bool:
+		b := uint64(0)
+		if v {
+			b = 1
+		}
+		buf = appendProtoVarint(buf, 2, b)
+	case string:
+		buf = appendProtoBytes(buf, 3, []byte(v))
+	case []byte:
+		buf = appendProtoBytes(buf, 4, v)
+	case int:
+		buf = appendProtoSint(buf, 5, int64(v))
+	case int8:
+		buf = appendProtoSint(buf, 5, int64(v))
+	case int16:
+		buf = appendProtoSint(buf, 5, int64(v))
+	case int32:
+		buf = appendProtoSint(buf, 5, int64(v))
+	case int64:
+		buf = appendProtoSint(buf, 5, v)
+	case uint:
+		if uint64(v) > math.MaxInt64 {
+			return nil, fmt.Errorf("value %v overflows int64", v)
+		}
+		buf = appendProtoSint(buf, 5, int64(v))
+	case uint8:
+		buf = appendProtoSint(buf, 5, int64(v))
+	case uint16:
+		buf = appendProtoSint(buf, 5, int64(v))
+	case uint32:
+		buf = appendProtoSint(buf, 5, int64(v))
+	case uint64:
+		if v > math.MaxInt64 {
+			return nil, fmt.Errorf("value %v overflows int64", v)
+		}
+		buf = appendProtoSint(buf, 5, int64(v))
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			buf = appendProtoSint(buf, 5, i)
+		} else if f, err := v.Float64(); err == nil {
+			buf = appendProtoDouble(buf, 1, f)
+		} else {
+			return nil, fmt.Errorf("invalid number %q", v)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", value)
+	}
+	return buf, nil
+}
+
+// unmarshalProtoValue decodes a Value message into float64, bool, string, []byte or int64
+func unmarshalProtoValue(data []byte) (any, error) {
+	var value any
+	err := walkProto(data, func(field int, wire int, num uint64, b []byte) error {
+		switch field {
+		case 1:
+			value = math.Float64frombits(num)
+		case 2:
+			value = num != 0
+		case 3:
+			value = string(b)
+		case 4:
+			value = append([]byte{}, b...)
+		case 5:
+			// zigzag 解码
+			value = int64(num>>1) ^ -int64(num&1)
+		}
+		return nil
+	})
+	return value, err
+}
+
+// appendProtoPayload encodes payload as map entries of field, in sorted key order
+func appendProtoPayload(buf []byte, field int, payload map[string]any) ([]byte, error) {
+	keys := make([]string, 0, len(payload))
+	for k := range payload {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var entry []byte
+		entry = appendProtoString(entry, 1, k)
+		if payload[k] != nil {
+			value, err := marshalProtoValue(payload[k])
+			if err != nil {
+				return nil, fmt.Errorf("payload %s: %v", k, err)
+			}
+			entry = appendProtoBytes(entry, 2, value)
+		}
+		buf = appendProtoBytes(buf, field, entry)
+	}
+	return buf, nil
+}
+
+// unmarshalProtoPayloadEntry decodes one map entry into payload, allocating it when needed
+func unmarshalProtoPayloadEntry(payload map[string]any, data []byte) (map[string]any, error) {
+	var key string
+	var value any
+	err := walkProto(data, func(field int, wire int, num uint64, b []byte) error {
+		var err error
+		switch field {
+		case 1:
+			key = string(b)
+		case 2:
+			value, err = unmarshalProtoValue(b)
+		}
+		return err
+	})
+	if err != nil {
+		return payload, err
+	}
+	if payload == nil {
+		payload = make(map[string]any)
+	}
+	payload[key] = value
+	return payload, nil
+}
+
+func appendProtoTimestamp(buf []byte, field int, t *time.Time) []byte {
+	if t == nil {
+		return buf
+	}
+	var ts []byte
+	if s := t.Unix(); s != 0 {
+		ts = appendProtoVarint(ts, 1, uint64(s))
+	}
+	if n := t.Nanosecond(); n != 0 {
+		ts = appendProtoVarint(ts, 2, uint64(n))
+	}
+	return appendProtoBytes(buf, field, ts)
+}
+
+func unmarshalProtoTimestamp(data []byte) (*time.Time, error) {
+	var seconds, nanos int64
+	err := walkProto(data, func(field int, wire int, num uint64, b []byte) error {
+		switch field {
+		case 1:
+			seconds = int64(num)
+		case 2:
+			nanos = int64(int32(num))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	t := time.Unix(seconds, nanos)
+	return &t, nil
+}
+
+func appendProtoTag(buf []byte, field int, wire int) []byte {
+	return binary.AppendUvarint(buf, uint64(field)<<3|uint64(wire))
+}
+
+func appendProtoVarint(buf []byte, field int, v uint64) []byte {
+	buf = appendProtoTag(buf, field, wireVarint)
+	return binary.AppendUvarint(buf, v)
+}
+
+func appendProtoSint(buf []byte, field int, v int64) []byte {
+	// zigzag 编码，使负数也能紧凑表示
+	return appendProtoVarint(buf, field, uint64(v<<1)^uint64(v>>63))
+}
+
+func appendProtoDouble(buf []byte, field int, v float64) []byte {
+	buf = appendProtoTag(buf, field, wireFixed64)
+	return binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+}
+
+func appendProtoBytes(buf []byte, field int, b []byte) []byte {
+	buf = appendProtoTag(buf, field, wireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// appendProtoString omits empty strings, matching proto3 default values
+func appendProtoString(buf []byte, field int, s string) []byte {
+	if s == "" {
+		return buf
+	}
+	return appendProtoBytes(buf, field, []byte(s))
+}
+
+// walkProto calls fn for each field in data. Varint and fixed values are passed in num,
+// length-delimited values in b.
+func walkProto(data []byte, fn func(field int, wire int, num uint64, b []byte) error) error {
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("invalid protobuf tag")
+		}
+		data = data[n:]
+		field, wire := int(tag>>3), int(tag&7)
+
+		var num uint64
+		var b []byte
+		switch wire {
+		case wireVarint:
+			num, n = binary.Uvarint(data)
+			if n <= 0 {
+				return fmt.Errorf("invalid varint in field %d", field)
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return fmt.Errorf("truncated fixed64 in field %d", field)
+			}
+			num = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return fmt.Errorf("truncated fixed32 in field %d", field)
+			}
+			num = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		case wireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return fmt.Errorf("truncated bytes in field %d", field)
+			}
+			b = data[n : n+int(length)]
+			data = data[n+int(length):]
+		default:
+			return fmt.Errorf("unsupported wire type %d in field %d", wire, field)
+		}
+		if err := fn(field, wire, num, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package edgeexpr
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestPushValue_MarshalRoundTrip(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC)
+
+	values := map[string]any{
+		"float":  21.5,
+		"bool":   true,
+		"string": "Fault",
+		"bytes":  []byte{0x01, 0x02, 0xFF},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			original := &PushValue{Key: "tag_" + name, Value: value, Timestamp: &ts}
+			data, err := original.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+
+			var decoded PushValue
+			if err := decoded.Unmarshal(data); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			if decoded.Key != original.Key {
+				t.Errorf("Expected key %s, got %s", original.Key, decoded.Key)
+			}
+			if decoded.Timestamp == nil || !decoded.Timestamp.Equal(ts) {
+				t.Errorf("Expected timestamp %v, got %v", ts, decoded.Timestamp)
+			}
+			if b, ok := value.([]byte); ok {
+				if got, ok := decoded.Value.([]byte); !ok || !bytes.Equal(got, b) {
+					t.Errorf("Expected value %v, got %v", b, decoded.Value)
+				}
+			} else if decoded.Value != value {
+				t.Errorf("Expected value %v (%T), got %v (%T)", value, value, decoded.Value, decoded.Value)
+			}
+		})
+	}
+
+	// 不支持的类型返回错误
+	if _, err := (&PushValue{Key: "bad", Value: struct{}{}}).Marshal(); err == nil {
+		t.Error("Expected error for unsupported value type")
+	}
+}
+
+func TestCommand_MarshalRoundTrip(t *testing.T) {
+	ts := time.Now()
+	original := &Command{
+		CommandID: "cmd-1",
+		Command:   "write",
+		Payload: map[string]any{
+			"setpoint": 42.5,
+			"enable":   false,
+			"mode":     "auto",
+			"raw":      []byte{0xAA},
+			"count":    -3,
+		},
+		Timestamp: &ts,
+	}
+
+	data, err := original.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded Command
+	if err := decoded.Unmarshal(data); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	if decoded.CommandID != "cmd-1" || decoded.Command != "write" {
+		t.Errorf("Expected cmd-1/write, got %s/%s", decoded.CommandID, decoded.Command)
+	}
+	if decoded.Payload["setpoint"] != 42.5 || decoded.Payload["enable"] != false || decoded.Payload["mode"] != "auto" {
+		t.Errorf("Unexpected payload: %v", decoded.Payload)
+	}
+	if raw, ok := decoded.Payload["raw"].([]byte); !ok || !bytes.Equal(raw, []byte{0xAA}) {
+		t.Errorf("Expected raw [170], got %v", decoded.Payload["raw"])
+	}
+	// 整数解码为 int64
+	if decoded.Payload["count"] != int64(-3) {
+		t.Errorf("Expected count -3, got %v (%T)", decoded.Payload["count"], decoded.Payload["count"])
+	}
+	if decoded.Timestamp == nil || !decoded.Timestamp.Equal(ts) {
+		t.Errorf("Expected timestamp %v, got %v", ts, decoded.Timestamp)
+	}
+}
+
+func TestCommandResponse_MarshalRoundTrip(t *testing.T) {
+	original := &CommandResponse{
+		CommandID: "cmd-1",
+		Message:   "done",
+		Success:   true,
+		Payload:   map[string]any{"result": "ok"},
+	}
+
+	data, err := original.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded CommandResponse
+	if err := decoded.Unmarshal(data); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if decoded.CommandID != "cmd-1" || decoded.Message != "done" || !decoded.Success {
+		t.Errorf("Unexpected response: %+v", decoded)
+	}
+	if decoded.Payload["result"] != "ok" {
+		t.Errorf("Expected result ok, got %v", decoded.Payload["result"])
+	}
+	if decoded.Timestamp != nil {
+		t.Errorf("Expected nil timestamp, got %v", decoded.Timestamp)
+	}
+}
@@ -1,12 +1,15 @@
 package edgeexpr
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"math"
 	"math/rand"
+	"reflect"
 	"regexp"
 	"strconv"
+	"sync"
 )
 
 // generate datatype enumeration
@@ -28,6 +31,7 @@ const (
 	DataTypeFloat32 DataType = "Float32"
 	DataTypeFloat64 DataType = "Float64"
 	DataTypeString  DataType = "String"
+	DataTypeRaw     DataType = "Raw" // opaque byte blob stored unchanged, without range checks or interpretation
 )
 
 func (dt DataType) String() string {
@@ -37,13 +41,59 @@ func (dt DataType) String() string {
 // DataTypeValidator is a validator for the "dataType" field enum values. It is called by the builders before save.
 func DataTypeValidator(dt DataType) error {
 	switch dt {
-	case DataTypeBool, DataTypeByte, DataTypeWord, DataTypeDWord, DataTypeInt8, DataTypeUInt8, DataTypeInt16, DataTypeUInt16, DataTypeInt32, DataTypeUInt32, DataTypeInt64, DataTypeUInt64, DataTypeFloat32, DataTypeFloat64, DataTypeString:
+	case DataTypeBool, DataTypeByte, DataTypeWord, DataTypeDWord, DataTypeInt8, DataTypeUInt8, DataTypeInt16, DataTypeUInt16, DataTypeInt32, DataTypeUInt32, DataTypeInt64, DataTypeUInt64, DataTypeFloat32, DataTypeFloat64, DataTypeString, DataTypeRaw:
 		return nil
 	default:
 		return fmt.Errorf("data: invalid enum value for dataType field: %q", dt)
 	}
 }
 
+// isNumeric reports whether values of the data type are cached as float64
+func (dt DataType) isNumeric() bool {
+	switch dt {
+	case DataTypeFloat32, DataTypeFloat64, DataTypeInt8, DataTypeUInt8, DataTypeInt16, DataTypeUInt16,
+		DataTypeInt32, DataTypeUInt32, DataTypeInt64, DataTypeUInt64:
+		return true
+	default:
+		return false
+	}
+}
+
+// isBytes reports whether values of the data type are cached as []byte
+func (dt DataType) isBytes() bool {
+	switch dt {
+	case DataTypeByte, DataTypeWord, DataTypeDWord, DataTypeRaw:
+		return true
+	default:
+		return false
+	}
+}
+
+// acceptsScriptType reports whether a script whose result has the static type t can feed a variable of
+// the data type. Results typed interface{} are only known at run time and are accepted.
+func (dt DataType) acceptsScriptType(t reflect.Type) bool {
+	if t == nil || t.Kind() == reflect.Interface {
+		return true
+	}
+	switch {
+	case dt.isNumeric():
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return true
+		}
+	case dt == DataTypeBool:
+		return t.Kind() == reflect.Bool
+	case dt == DataTypeString:
+		return t.Kind() == reflect.String
+	case dt.isBytes():
+		return t.Kind() == reflect.String ||
+			(t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() == reflect.Uint8
+	}
+	return false
+}
+
 func (DataType) Values() []string {
 	return []string{
 		string(DataTypeBool),
@@ -61,9 +111,57 @@ func (DataType) Values() []string {
 		string(DataTypeFloat32),
 		string(DataTypeFloat64),
 		string(DataTypeString),
+		string(DataTypeRaw),
 	}
 }
 
+// DataTypeInfo describes a DataType for configuration UIs
+type DataTypeInfo struct {
+	DataType      DataType `json:"data_type"`
+	DisplayName   string   `json:"display_name"`
+	Bytes         int      `json:"bytes"`          // 0 for variable length String and Raw
+	Numeric       bool     `json:"numeric"`        // cached as float64, supports statistics
+	Integer       bool     `json:"integer"`        // numeric without fraction
+	SupportsArray bool     `json:"supports_array"` // value is a byte array with bit access
+}
+
+var dataTypeDisplayNames = map[DataType]string{
+	DataTypeBool:    "Boolean",
+	DataTypeByte:    "Byte (8 bits)",
+	DataTypeWord:    "Word (16 bits)",
+	DataTypeDWord:   "Double Word (32 bits)",
+	DataTypeInt8:    "Signed 8-bit Integer",
+	DataTypeUInt8:   "Unsigned 8-bit Integer",
+	DataTypeInt16:   "Signed 16-bit Integer",
+	DataTypeUInt16:  "Unsigned 16-bit Integer",
+	DataTypeInt32:   "Signed 32-bit Integer",
+	DataTypeUInt32:  "Unsigned 32-bit Integer",
+	DataTypeInt64:   "Signed 64-bit Integer",
+	DataTypeUInt64:  "Unsigned 64-bit Integer",
+	DataTypeFloat32: "32-bit Float",
+	DataTypeFloat64: "64-bit Float",
+	DataTypeString:  "String",
+	DataTypeRaw:     "Raw Bytes",
+}
+
+// DataTypeCatalog returns every DataType with its metadata, in the order of Values()
+func DataTypeCatalog() []DataTypeInfo {
+	values := DataType("").Values()
+	catalog := make([]DataTypeInfo, 0, len(values))
+	for _, value := range values {
+		dt, bytes, _ := ParseDataType(value)
+		catalog = append(catalog, DataTypeInfo{
+			DataType:      dt,
+			DisplayName:   dataTypeDisplayNames[dt],
+			Bytes:         bytes,
+			Numeric:       dt.isNumeric(),
+			Integer:       dt.isNumeric() && dt != DataTypeFloat32 && dt != DataTypeFloat64,
+			SupportsArray: dt.isBytes(),
+		})
+	}
+	return catalog
+}
+
 func (dt DataType) MarshalGQL(w io.Writer) {
 	io.WriteString(w, strconv.Quote(string(dt)))
 }
@@ -81,6 +179,38 @@ func (dt *DataType) UnmarshalGQL(val interface{}) error {
 	return nil
 }
 
+type dataTypeAlias struct {
+	dataType DataType
+	bytes    int
+}
+
+// dataTypeAliases maps vendor type names to a data type and byte size
+var (
+	dataTypeAliases   = map[string]dataTypeAlias{}
+	dataTypeAliasesMu sync.RWMutex // 注册可能与 ParseDataType 并发
+)
+
+// RegisterDataTypeAlias registers (or replaces) a vendor type name parsed by ParseDataType as dt with the given byte size.
+// The built-in data type names always take precedence. It is safe to call concurrently with ParseDataType.
+func RegisterDataTypeAlias(name string, dt DataType, bytes int) {
+	dataTypeAliasesMu.Lock()
+	defer dataTypeAliasesMu.Unlock()
+	dataTypeAliases[name] = dataTypeAlias{dataType: dt, bytes: bytes}
+}
+
+func init() {
+	// Siemens
+	RegisterDataTypeAlias("S5Time", DataTypeInt16, 2) // ms
+	RegisterDataTypeAlias("Time", DataTypeInt32, 4)   // ms
+	RegisterDataTypeAlias("LTime", DataTypeInt64, 8)  // ns
+	RegisterDataTypeAlias("DTL", DataTypeString, 12)
+	RegisterDataTypeAlias("Date", DataTypeString, 2)
+	RegisterDataTypeAlias("Date_And_Time", DataTypeString, 8)
+	RegisterDataTypeAlias("LDT", DataTypeString, 8)
+	RegisterDataTypeAlias("LTime_Of_Day", DataTypeString, 8)
+	RegisterDataTypeAlias("Time_Of_Day", DataTypeString, 4)
+}
+
 func ParseDataType(dt string) (DataType, int, error) {
 	switch dt {
 	case string(DataTypeBool):
@@ -113,25 +243,15 @@ func ParseDataType(dt string) (DataType, int, error) {
 		return DataTypeFloat64, 8, nil
 	case string(DataTypeString):
 		return DataTypeString, 0, nil // String has no fixed size
-	case "S5Time": //ms
-		return DataTypeInt16, 2, nil
-	case "Time": //ms
-		return DataTypeInt32, 4, nil
-	case "LTime": //ns
-		return DataTypeInt64, 8, nil
-	case "DTL":
-		return DataTypeString, 12, nil
-	case "Date":
-		return DataTypeString, 2, nil
-	case "Date_And_Time":
-		return DataTypeString, 8, nil
-	case "LDT":
-		return DataTypeString, 8, nil
-	case "LTime_Of_Day":
-		return DataTypeString, 8, nil
-	case "Time_Of_Day":
-		return DataTypeString, 4, nil
+	case string(DataTypeRaw):
+		return DataTypeRaw, 0, nil // Raw has no fixed size
 	default:
+		dataTypeAliasesMu.RLock()
+		alias, ok := dataTypeAliases[dt]
+		dataTypeAliasesMu.RUnlock()
+		if ok {
+			return alias.dataType, alias.bytes, nil
+		}
 		// for siemens like "WString[10]", "String[20]", etc.
 		reg, _ := regexp.Compile(`^(W)?String\[(\d+)\]$`)
 		match := reg.FindStringSubmatch(dt)
@@ -146,13 +266,60 @@ func ParseDataType(dt string) (DataType, int, error) {
 	return "", 0, fmt.Errorf("unknown data type: %s", dt)
 }
 
+// Largest integers that float32/float64 can represent without losing precision
+const (
+	maxExactFloat32Int uint64 = 1 << 24
+	maxExactFloat64Int uint64 = 1 << 53
+)
+
+// StrictFloatConversion makes integer to float conversions whose magnitude exceeds the
+// exactly representable range (2^24 for float32, 2^53 for float64) return an error wrapping ErrPrecisionLoss.
+// When false (default) the value is converted and reported to OnPrecisionLoss, if set.
+var StrictFloatConversion = false
+
+// OnPrecisionLoss, when set, is called for each lenient integer to float conversion that loses precision
+var OnPrecisionLoss func(value any, target string)
+
+// checkFloatPrecision flags integers whose magnitude cannot be represented exactly as the target float type
+func checkFloatPrecision(magnitude, limit uint64, value any, target string) error {
+	if magnitude <= limit {
+		return nil
+	}
+	if StrictFloatConversion {
+		return withKind(ErrPrecisionLoss, fmt.Errorf("cannot convert %v (type %T) to %s: precision loss", value, value, target))
+	}
+	if OnPrecisionLoss != nil {
+		OnPrecisionLoss(value, target)
+	}
+	return nil
+}
+
+// int64Magnitude returns |v| without overflowing on math.MinInt64
+func int64Magnitude(v int64) uint64 {
+	if v < 0 {
+		return uint64(-(v + 1)) + 1
+	}
+	return uint64(v)
+}
+
+// ConvertToFloat64 converts a numeric value to float64.
+// Integers beyond 2^53 lose precision, see StrictFloatConversion.
+// Errors wrap ErrTypeConversion.
 func ConvertToFloat64(value any) (float64, error) {
+	f, err := convertToFloat64(value)
+	return f, withKind(ErrTypeConversion, err)
+}
+
+func convertToFloat64(value any) (float64, error) {
 	switch v := value.(type) {
 	case float64:
 		return v, nil
 	case float32:
 		return float64(v), nil
 	case int:
+		if err := checkFloatPrecision(int64Magnitude(int64(v)), maxExactFloat64Int, value, "float64"); err != nil {
+			return 0, err
+		}
 		return float64(v), nil
 	case int8:
 		return float64(v), nil
@@ -161,8 +328,14 @@ func ConvertToFloat64(value any) (float64, error) {
 	case int32:
 		return float64(v), nil
 	case int64:
+		if err := checkFloatPrecision(int64Magnitude(v), maxExactFloat64Int, value, "float64"); err != nil {
+			return 0, err
+		}
 		return float64(v), nil
 	case uint:
+		if err := checkFloatPrecision(uint64(v), maxExactFloat64Int, value, "float64"); err != nil {
+			return 0, err
+		}
 		return float64(v), nil
 	case uint8:
 		return float64(v), nil
@@ -171,13 +344,206 @@ func ConvertToFloat64(value any) (float64, error) {
 	case uint32:
 		return float64(v), nil
 	case uint64:
+		if err := checkFloatPrecision(v, maxExactFloat64Int, value, "float64"); err != nil {
+			return 0, err
+		}
 		return float64(v), nil
+	case json.Number:
+		return v.Float64()
 	default:
 		return 0, fmt.Errorf("unsupported type: %T", value)
 	}
 }
 
+// OverflowPolicy controls how raw values outside the range of the declared data type are handled
+type OverflowPolicy string
+
+const (
+	OverflowError OverflowPolicy = "error" // reject values outside the range (default)
+	OverflowClamp OverflowPolicy = "clamp" // clamp values to the nearest bound
+)
+
+// ScaleOverflow is the policy applied by Variable.WriteValue to raw values before Scale and Offset,
+// so the scaled engineering value may lie outside the device type's range
+var ScaleOverflow = OverflowError
+
+// OnOverflowClamp, when set, is called for each value clamped under OverflowClamp
+var OnOverflowClamp func(value float64, dataType DataType)
+
+// numericRange returns the bounds of a numeric data type; Float64 is unbounded
+func (d DataType) numericRange() (float64, float64, bool) {
+	switch d {
+	case DataTypeInt8:
+		return math.MinInt8, math.MaxInt8, true
+	case DataTypeUInt8:
+		return 0, math.MaxUint8, true
+	case DataTypeInt16:
+		return math.MinInt16, math.MaxInt16, true
+	case DataTypeUInt16:
+		return 0, math.MaxUint16, true
+	case DataTypeInt32:
+		return math.MinInt32, math.MaxInt32, true
+	case DataTypeUInt32:
+		return 0, math.MaxUint32, true
+	case DataTypeInt64:
+		return math.MinInt64, math.MaxInt64, true
+	case DataTypeUInt64:
+		return 0, math.MaxUint64, true
+	case DataTypeFloat32:
+		return -math.MaxFloat32, math.MaxFloat32, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// checkOverflow checks v against the range of d according to ScaleOverflow
+func (d DataType) checkOverflow(v float64) (float64, error) {
+	lo, hi, ok := d.numericRange()
+	if !ok || (v >= lo && v <= hi) {
+		return v, nil
+	}
+	if ScaleOverflow == OverflowClamp {
+		if OnOverflowClamp != nil {
+			OnOverflowClamp(v, d)
+		}
+		return math.Max(lo, math.Min(hi, v)), nil
+	}
+	return 0, fmt.Errorf("value %v is out of range for %s", v, d)
+}
+
+// ByteOrder is the byte order of a connection, used to encode and decode Word/DWord values
+type ByteOrder string
+
+const (
+	ByteOrderDefault ByteOrder = ""       // same as ByteOrderLittle
+	ByteOrderLittle  ByteOrder = "little" // least significant byte first
+	ByteOrderBig     ByteOrder = "big"    // most significant byte first
+)
+
+func ByteOrderValidator(order ByteOrder) error {
+	switch order {
+	case ByteOrderDefault, ByteOrderLittle, ByteOrderBig:
+		return nil
+	default:
+		return fmt.Errorf("invalid byte order: %q", order)
+	}
+}
+
+// DecodeUint interprets up to 8 bytes as an unsigned integer in the byte order
+func (o ByteOrder) DecodeUint(b []byte) uint64 {
+	if len(b) > 8 {
+		b = b[:8]
+	}
+	var value uint64
+	for i, x := range b {
+		if o == ByteOrderBig {
+			value = value<<8 | uint64(x)
+		} else {
+			value |= uint64(x) << (i * 8)
+		}
+	}
+	return value
+}
+
+// TruncationPolicy controls how []byte values longer than a Byte/Word/DWord are converted
+type TruncationPolicy string
+
+const (
+	TruncationError TruncationPolicy = "error" // reject values that are too long (default)
+	TruncationHead  TruncationPolicy = "head"  // keep the first N bytes
+	TruncationTail  TruncationPolicy = "tail"  // keep the last N bytes
+)
+
+// ByteTruncation is the policy applied by ConvertFromAny to over-long []byte values
+var ByteTruncation = TruncationError
+
+// truncateBytes shortens v to size bytes according to ByteTruncation
+func truncateBytes(v []byte, size int) ([]byte, error) {
+	if len(v) <= size {
+		return v, nil
+	}
+	switch ByteTruncation {
+	case TruncationHead:
+		return v[:size], nil
+	case TruncationTail:
+		return v[len(v)-size:], nil
+	default:
+		return nil, fmt.Errorf("cannot convert %T to [%d]byte: too long", v, size)
+	}
+}
+
+// normalizeJSONNumber converts a json.Number to int64 when it is integral, float64 otherwise
+func normalizeJSONNumber(n json.Number) (any, error) {
+	if i, err := n.Int64(); err == nil {
+		return i, nil
+	}
+	if f, err := n.Float64(); err == nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("cannot convert json.Number %q to a number", n.String())
+}
+
+// ConvertFromAny converts value to the Go representation of the data type. Errors wrap ErrTypeConversion.
 func (dt DataType) ConvertFromAny(value any) (any, error) {
+	v, err := dt.convertFromAny(value)
+	return v, withKind(ErrTypeConversion, err)
+}
+
+func (dt DataType) convertFromAny(value any) (any, error) {
+	if dt.matches(value) {
+		return value, nil
+	}
+	return dt.convertSwitch(value)
+}
+
+// matches reports whether value already has the Go type of the data type, which
+// convertSwitch would return unchanged. This skips the conversion switch on the device read path.
+func (dt DataType) matches(value any) bool {
+	switch value.(type) {
+	case bool:
+		return dt == DataTypeBool
+	case int8:
+		return dt == DataTypeInt8
+	case int16:
+		return dt == DataTypeInt16
+	case int32:
+		return dt == DataTypeInt32
+	case int64:
+		return dt == DataTypeInt64
+	case uint8:
+		return dt == DataTypeUInt8
+	case uint16:
+		return dt == DataTypeUInt16
+	case uint32:
+		return dt == DataTypeUInt32
+	case uint64:
+		return dt == DataTypeUInt64
+	case float32:
+		return dt == DataTypeFloat32
+	case float64:
+		return dt == DataTypeFloat64
+	case string:
+		return dt == DataTypeString
+	case [1]byte:
+		return dt == DataTypeByte
+	case [2]byte:
+		return dt == DataTypeWord
+	case [4]byte:
+		return dt == DataTypeDWord
+	default:
+		return false
+	}
+}
+
+func (dt DataType) convertSwitch(value any) (any, error) {
+	// Values decoded with json.Decoder.UseNumber() arrive as json.Number
+	if n, ok := value.(json.Number); ok {
+		normalized, err := normalizeJSONNumber(n)
+		if err != nil {
+			return nil, err
+		}
+		value = normalized
+	}
 	switch dt {
 	case DataTypeBool:
 		switch v := value.(type) {
@@ -591,8 +957,9 @@ func (dt DataType) ConvertFromAny(value any) (any, error) {
 		case int32:
 			return float32(v), nil
 		case int64:
-			if float64(v) > math.MaxFloat32 || float64(v) < -math.MaxFloat32 {
-				return nil, fmt.Errorf("cannot convert %v (type %T) to float32: out of range", v, value)
+			// float32 represents integers exactly only up to 2^24
+			if err := checkFloatPrecision(int64Magnitude(v), maxExactFloat32Int, value, "float32"); err != nil {
+				return nil, err
 			}
 			return float32(v), nil
 		case uint:
@@ -607,8 +974,8 @@ func (dt DataType) ConvertFromAny(value any) (any, error) {
 		case uint32:
 			return float32(v), nil
 		case uint64:
-			if float64(v) > math.MaxFloat32 {
-				return nil, fmt.Errorf("cannot convert %v (type %T) to float32: out of range", v, value)
+			if err := checkFloatPrecision(v, maxExactFloat32Int, value, "float32"); err != nil {
+				return nil, err
 			}
 			return float32(v), nil
 		default:
@@ -621,6 +988,10 @@ func (dt DataType) ConvertFromAny(value any) (any, error) {
 		case float32:
 			return float64(v), nil
 		case int:
+			// float64 represents integers exactly only up to 2^53
+			if err := checkFloatPrecision(int64Magnitude(int64(v)), maxExactFloat64Int, value, "float64"); err != nil {
+				return nil, err
+			}
 			return float64(v), nil
 		case int8:
 			return float64(v), nil
@@ -629,8 +1000,14 @@ func (dt DataType) ConvertFromAny(value any) (any, error) {
 		case int32:
 			return float64(v), nil
 		case int64:
+			if err := checkFloatPrecision(int64Magnitude(v), maxExactFloat64Int, value, "float64"); err != nil {
+				return nil, err
+			}
 			return float64(v), nil
 		case uint:
+			if err := checkFloatPrecision(uint64(v), maxExactFloat64Int, value, "float64"); err != nil {
+				return nil, err
+			}
 			return float64(v), nil
 		case uint8:
 			return float64(v), nil
@@ -639,6 +1016,9 @@ func (dt DataType) ConvertFromAny(value any) (any, error) {
 		case uint32:
 			return float64(v), nil
 		case uint64:
+			if err := checkFloatPrecision(v, maxExactFloat64Int, value, "float64"); err != nil {
+				return nil, err
+			}
 			return float64(v), nil
 		default:
 			return nil, fmt.Errorf("cannot convert %T to float64", value)
@@ -655,8 +1035,9 @@ func (dt DataType) ConvertFromAny(value any) (any, error) {
 	case DataTypeByte:
 		switch v := value.(type) {
 		case []byte:
-			if len(v) > 1 {
-				return nil, fmt.Errorf("cannot convert %T to [1]byte: too long", value)
+			v, err := truncateBytes(v, 1)
+			if err != nil {
+				return nil, err
 			}
 			var arr [1]byte
 			copy(arr[:], v)
@@ -723,8 +1104,9 @@ func (dt DataType) ConvertFromAny(value any) (any, error) {
 	case DataTypeWord:
 		switch v := value.(type) {
 		case []byte:
-			if len(v) > 2 {
-				return nil, fmt.Errorf("cannot convert %T to [2]byte: too long", value)
+			v, err := truncateBytes(v, 2)
+			if err != nil {
+				return nil, err
 			}
 			var arr [2]byte
 			copy(arr[:], v)
@@ -789,8 +1171,9 @@ func (dt DataType) ConvertFromAny(value any) (any, error) {
 	case DataTypeDWord:
 		switch v := value.(type) {
 		case []byte:
-			if len(v) > 4 {
-				return nil, fmt.Errorf("cannot convert %T to [4]byte: too long", value)
+			v, err := truncateBytes(v, 4)
+			if err != nil {
+				return nil, err
 			}
 			var arr [4]byte
 			copy(arr[:], v)
@@ -848,6 +1231,13 @@ func (dt DataType) ConvertFromAny(value any) (any, error) {
 		default:
 			return nil, fmt.Errorf("cannot convert %T to [4]byte", value)
 		}
+	case DataTypeRaw:
+		// 原样保存，只复制避免与调用方共享底层数组
+		b, err := convertToBytes(value)
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert %T to raw bytes", value)
+		}
+		return append([]byte{}, b...), nil
 	default:
 		return nil, fmt.Errorf("unsupported data type: %v", dt)
 	}
@@ -896,12 +1286,22 @@ func (dt DataType) GenerateRandomValue() (any, error) {
 		var arr [4]byte
 		rand.Read(arr[:])
 		return arr, nil
+	case DataTypeRaw:
+		blob := make([]byte, rand.Intn(16)+1)
+		rand.Read(blob)
+		return blob, nil
 	default:
 		return nil, fmt.Errorf("unsupported data type for random generation: %v", dt)
 	}
 }
 
+// ConvertToBytes converts a string or byte array value to []byte. Errors wrap ErrTypeConversion.
 func ConvertToBytes(value any) ([]byte, error) {
+	b, err := convertToBytes(value)
+	return b, withKind(ErrTypeConversion, err)
+}
+
+func convertToBytes(value any) ([]byte, error) {
 	switch v := value.(type) {
 	case []byte:
 		return v, nil
@@ -0,0 +1,285 @@
+package edgeexpr
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestDataType_ConvertFromAny_JSONNumber(t *testing.T) {
+	v, err := DataTypeInt16.ConvertFromAny(json.Number("42"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if v != int16(42) {
+		t.Errorf("Expected int16(42), got %v (%T)", v, v)
+	}
+
+	v, err = DataTypeFloat32.ConvertFromAny(json.Number("1.5"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if v != float32(1.5) {
+		t.Errorf("Expected float32(1.5), got %v (%T)", v, v)
+	}
+
+	if _, err := DataTypeUInt8.ConvertFromAny(json.Number("300")); err == nil {
+		t.Error("Expected out of range error for json.Number 300 to UInt8")
+	}
+
+	if _, err := DataTypeInt32.ConvertFromAny(json.Number("abc")); err == nil {
+		t.Error("Expected error for invalid json.Number")
+	}
+
+	f, err := ConvertToFloat64(json.Number("2.25"))
+	if err != nil || f != 2.25 {
+		t.Errorf("Expected 2.25 from ConvertToFloat64, got %v, %v", f, err)
+	}
+}
+
+func TestDataType_ConvertFromAny_FloatPrecision(t *testing.T) {
+	defer func() { StrictFloatConversion = false }()
+
+	exact := uint64(1) << 53
+	beyond := exact + 1
+
+	StrictFloatConversion = true
+
+	if v, err := DataTypeFloat64.ConvertFromAny(exact); err != nil || v != float64(exact) {
+		t.Errorf("Expected 2^53 to convert exactly, got %v, %v", v, err)
+	}
+	if v, err := DataTypeFloat64.ConvertFromAny(-int64(exact)); err != nil || v != -float64(exact) {
+		t.Errorf("Expected -2^53 to convert exactly, got %v, %v", v, err)
+	}
+	if _, err := DataTypeFloat64.ConvertFromAny(beyond); err == nil {
+		t.Error("Expected precision error for uint64 2^53+1 in strict mode")
+	}
+	if _, err := DataTypeFloat64.ConvertFromAny(-int64(beyond)); err == nil {
+		t.Error("Expected precision error for int64 -(2^53+1) in strict mode")
+	}
+	if _, err := ConvertToFloat64(int64(beyond)); !errors.Is(err, ErrPrecisionLoss) || !errors.Is(err, ErrTypeConversion) {
+		t.Errorf("Expected ErrPrecisionLoss and ErrTypeConversion from ConvertToFloat64 in strict mode, got %v", err)
+	}
+	if _, err := ConvertToFloat64(int(beyond)); !errors.Is(err, ErrPrecisionLoss) {
+		t.Errorf("Expected ErrPrecisionLoss from ConvertToFloat64 for int, got %v", err)
+	}
+	if _, err := ConvertToFloat64(uint(beyond)); !errors.Is(err, ErrPrecisionLoss) {
+		t.Errorf("Expected ErrPrecisionLoss from ConvertToFloat64 for uint, got %v", err)
+	}
+	if _, err := DataTypeFloat32.ConvertFromAny(int64(1<<24 + 1)); err == nil {
+		t.Error("Expected precision error for int64 2^24+1 to float32 in strict mode")
+	}
+	if _, err := DataTypeFloat32.ConvertFromAny(int64(1 << 24)); err != nil {
+		t.Errorf("Expected 2^24 to convert to float32 exactly, got %v", err)
+	}
+
+	StrictFloatConversion = false
+
+	// 宽松模式下通过回调报告精度损失
+	var lost []string
+	OnPrecisionLoss = func(value any, target string) { lost = append(lost, target) }
+	defer func() { OnPrecisionLoss = nil }()
+	if v, err := DataTypeFloat64.ConvertFromAny(beyond); err != nil || v != float64(beyond) {
+		t.Errorf("Expected lenient conversion of 2^53+1, got %v, %v", v, err)
+	}
+	if len(lost) != 1 || lost[0] != "float64" {
+		t.Errorf("Expected one precision loss report for float64, got %v", lost)
+	}
+}
+
+func TestDataTypeCatalog(t *testing.T) {
+	expectedSizes := map[DataType]int{
+		DataTypeBool:    1,
+		DataTypeByte:    1,
+		DataTypeWord:    2,
+		DataTypeDWord:   4,
+		DataTypeInt8:    1,
+		DataTypeUInt8:   1,
+		DataTypeInt16:   2,
+		DataTypeUInt16:  2,
+		DataTypeInt32:   4,
+		DataTypeUInt32:  4,
+		DataTypeInt64:   8,
+		DataTypeUInt64:  8,
+		DataTypeFloat32: 4,
+		DataTypeFloat64: 8,
+		DataTypeString:  0,
+		DataTypeRaw:     0,
+	}
+
+	catalog := DataTypeCatalog()
+	if len(catalog) != len(expectedSizes) {
+		t.Fatalf("Expected %d data types, got %d", len(expectedSizes), len(catalog))
+	}
+	for _, info := range catalog {
+		size, ok := expectedSizes[info.DataType]
+		if !ok {
+			t.Errorf("Unexpected data type %s", info.DataType)
+			continue
+		}
+		if info.Bytes != size {
+			t.Errorf("Expected %s to be %d bytes, got %d", info.DataType, size, info.Bytes)
+		}
+		if info.DisplayName == "" {
+			t.Errorf("Expected display name for %s", info.DataType)
+		}
+	}
+
+	byType := make(map[DataType]DataTypeInfo)
+	for _, info := range catalog {
+		byType[info.DataType] = info
+	}
+	if info := byType[DataTypeFloat32]; !info.Numeric || info.Integer {
+		t.Errorf("Expected Float32 to be numeric and not integer, got %+v", info)
+	}
+	if info := byType[DataTypeUInt16]; !info.Numeric || !info.Integer {
+		t.Errorf("Expected UInt16 to be a numeric integer, got %+v", info)
+	}
+	if info := byType[DataTypeWord]; info.Numeric || !info.SupportsArray {
+		t.Errorf("Expected Word to be a byte array, got %+v", info)
+	}
+}
+
+func TestDataType_ConvertFromAny_ByteTruncation(t *testing.T) {
+	defer func() { ByteTruncation = TruncationError }()
+
+	input := []byte{1, 2, 3, 4, 5, 6}
+
+	ByteTruncation = TruncationError
+	if _, err := DataTypeDWord.ConvertFromAny(input); err == nil {
+		t.Error("Expected error for 6-byte input to DWord under error policy")
+	}
+
+	ByteTruncation = TruncationHead
+	if v, err := DataTypeDWord.ConvertFromAny(input); err != nil || v != [4]byte{1, 2, 3, 4} {
+		t.Errorf("Expected head bytes [1 2 3 4], got %v, %v", v, err)
+	}
+
+	ByteTruncation = TruncationTail
+	if v, err := DataTypeDWord.ConvertFromAny(input); err != nil || v != [4]byte{3, 4, 5, 6} {
+		t.Errorf("Expected tail bytes [3 4 5 6], got %v, %v", v, err)
+	}
+}
+
+func TestConversionErrorsWrapErrTypeConversion(t *testing.T) {
+	if _, err := DataTypeInt16.ConvertFromAny("abc"); !errors.Is(err, ErrTypeConversion) {
+		t.Errorf("Expected ErrTypeConversion from ConvertFromAny, got: %v", err)
+	}
+	if _, err := ConvertToFloat64(struct{}{}); !errors.Is(err, ErrTypeConversion) {
+		t.Errorf("Expected ErrTypeConversion from ConvertToFloat64, got: %v", err)
+	}
+	if _, err := ConvertToBytes(1.5); !errors.Is(err, ErrTypeConversion) {
+		t.Errorf("Expected ErrTypeConversion from ConvertToBytes, got: %v", err)
+	}
+	// 保留原始错误信息
+	if _, err := ConvertToFloat64(struct{}{}); err.Error() != "unsupported type: struct {}" {
+		t.Errorf("Expected original message, got: %v", err)
+	}
+	if _, err := DataTypeInt16.ConvertFromAny(int16(1)); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestDataType_ConvertFromAny_SameTypeFastPath(t *testing.T) {
+	// 快速路径的结果必须与完整转换一致
+	values := map[DataType]any{
+		DataTypeBool:    true,
+		DataTypeInt8:    int8(-8),
+		DataTypeInt16:   int16(-16),
+		DataTypeInt32:   int32(-32),
+		DataTypeInt64:   int64(-64),
+		DataTypeUInt8:   uint8(8),
+		DataTypeUInt16:  uint16(16),
+		DataTypeUInt32:  uint32(32),
+		DataTypeUInt64:  uint64(64),
+		DataTypeFloat32: float32(1.5),
+		DataTypeFloat64: 2.5,
+		DataTypeString:  "abc",
+		DataTypeByte:    [1]byte{1},
+		DataTypeWord:    [2]byte{1, 2},
+		DataTypeDWord:   [4]byte{1, 2, 3, 4},
+	}
+	for dt, value := range values {
+		if !dt.matches(value) {
+			t.Errorf("Expected %T to match %s", value, dt)
+		}
+		fast, err := dt.ConvertFromAny(value)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", dt, err)
+		}
+		slow, err := dt.convertSwitch(value)
+		if err != nil {
+			t.Errorf("%s: unexpected error from full conversion: %v", dt, err)
+		}
+		if fast != slow {
+			t.Errorf("%s: fast path returned %v (%T), full conversion %v (%T)", dt, fast, fast, slow, slow)
+		}
+	}
+
+	if DataTypeFloat32.matches(1.5) {
+		t.Error("Expected float64 not to match Float32")
+	}
+}
+
+func BenchmarkConvertFromAny(b *testing.B) {
+	cases := []struct {
+		name  string
+		dt    DataType
+		value any
+	}{
+		{"Float32", DataTypeFloat32, float32(21.5)},
+		{"Int16", DataTypeInt16, int16(-1234)},
+	}
+	for _, c := range cases {
+		// FastPath 为当前实现，Switch 为加入快速路径之前的完整转换
+		b.Run(c.name+"/FastPath", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				c.dt.ConvertFromAny(c.value)
+			}
+		})
+		b.Run(c.name+"/Switch", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				c.dt.convertSwitch(c.value)
+			}
+		})
+	}
+}
+
+func TestRegisterDataTypeAlias(t *testing.T) {
+	defer delete(dataTypeAliases, "REAL_BE")
+
+	if _, _, err := ParseDataType("REAL_BE"); err == nil {
+		t.Fatal("Expected unknown alias to fail before registration")
+	}
+
+	RegisterDataTypeAlias("REAL_BE", DataTypeFloat32, 4)
+	dt, size, err := ParseDataType("REAL_BE")
+	if err != nil || dt != DataTypeFloat32 || size != 4 {
+		t.Errorf("Expected Float32/4, got %s/%d (err: %v)", dt, size, err)
+	}
+
+	// 内置别名通过同一机制注册
+	if dt, size, err := ParseDataType("S5Time"); err != nil || dt != DataTypeInt16 || size != 2 {
+		t.Errorf("Expected built-in S5Time as Int16/2, got %s/%d (err: %v)", dt, size, err)
+	}
+	if _, ok := dataTypeAliases["DTL"]; !ok {
+		t.Error("Expected DTL to be registered as an alias")
+	}
+
+	// 注册与解析并发时不应产生数据竞争（配合 -race 运行）
+	defer delete(dataTypeAliases, "INT_BE")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			RegisterDataTypeAlias("INT_BE", DataTypeInt16, 2)
+		}()
+		go func() {
+			defer wg.Done()
+			ParseDataType("REAL_BE")
+		}()
+	}
+	wg.Wait()
+}
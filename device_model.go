@@ -1,24 +1,49 @@
 package edgeexpr
 
 import (
-	"crypto/md5"
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
 )
 
 type DeviceModel struct {
-	Connections map[string]string    `json:"connections"` // map of connection name to connection type
-	Variables   map[string]*Variable `json:"variables"`   // map of variable name to Variable struct
+	Connections          map[string]string    `json:"connections"`           // map of connection name to connection type
+	Variables            map[string]*Variable `json:"variables"`             // map of variable name to Variable struct
+	ByteOrders           map[string]ByteOrder `json:"byte_orders,omitempty"` // Optional map of connection name to byte order, little endian when unset
+	DefaultCacheDuration *time.Duration       `json:"-"`                     // Cache duration for variables without cache_duration, 1 minute when unset
+}
+
+func (m *DeviceModel) MarshalJSON() ([]byte, error) {
+	type Alias DeviceModel
+	aux := &struct {
+		*Alias
+		DefaultCacheDurationStr string `json:"default_cache_duration,omitempty"`
+	}{
+		Alias: (*Alias)(m),
+	}
+	if m.DefaultCacheDuration != nil {
+		aux.DefaultCacheDurationStr = m.DefaultCacheDuration.String()
+	}
+	return json.Marshal(aux)
 }
 
 func (m *DeviceModel) UnmarshalJSON(data []byte) error {
 	type Alias DeviceModel
-	aux := (*Alias)(m)
+	aux := &struct {
+		*Alias
+		DefaultCacheDurationStr string `json:"default_cache_duration"`
+	}{
+		Alias: (*Alias)(m),
+	}
 	if err := json.Unmarshal(data, aux); err != nil {
 		return err
 	}
@@ -30,42 +55,455 @@ func (m *DeviceModel) UnmarshalJSON(data []byte) error {
 		m.Variables = make(map[string]*Variable)
 	}
 
-	env := make(map[string]any)
-	for key, variable := range m.Variables {
-		if variable.Cache != nil {
-			env[key] = variable.Cache
+	if aux.DefaultCacheDurationStr != "" {
+		duration, err := time.ParseDuration(aux.DefaultCacheDurationStr)
+		if err != nil {
+			return fmt.Errorf("invalid default_cache_duration format: %v", err)
+		}
+		m.DefaultCacheDuration = &duration
+		// Variables were decoded before the model default was known, recreate their caches
+		for _, variable := range m.Variables {
+			if variable.CacheDuration == nil {
+				variable.Cache = variable.createCacheWithDefault(duration)
+				variable.createRawCache()
+			}
 		}
 	}
 
+	for conn, order := range m.ByteOrders {
+		if err := ByteOrderValidator(order); err != nil {
+			return fmt.Errorf("connection %s: %v", conn, err)
+		}
+	}
+	// Variables inherit the byte order of their connection
+	for _, variable := range m.Variables {
+		variable.ByteOrder = m.ByteOrders[variable.Connection]
+	}
+
+	env := m.EnvSnapshot()
+
 	keyRegex := regexp.MustCompile(`^\w+$`)
 
-	var errs []string
+	var errs []error
 	for key, variable := range m.Variables {
 		if !keyRegex.MatchString(key) {
-			errs = append(errs, fmt.Sprintf("Invalid variable key: %s", key))
+			errs = append(errs, fmt.Errorf("%w: %s", ErrInvalidKey, key))
 		}
 		if key != variable.Key {
-			errs = append(errs, fmt.Sprintf("Variable key mismatch: %s != %s", key, variable.Key))
+			errs = append(errs, fmt.Errorf("%w: %s != %s", ErrKeyMismatch, key, variable.Key))
+		}
+		// 按所属连接的类型校验数据类型和地址
+		if err := variable.Validate(m.Connections[variable.Connection]); err != nil {
+			errs = append(errs, err)
 		}
 		if variable.Connection == "" && variable.Script != "" {
-			program, err := expr.Compile(variable.Script, expr.Env(env))
+			program, err := expr.Compile(variable.Script, ScriptOptions(env)...)
 			if err != nil {
-				errs = append(errs, fmt.Errorf("%s: %v", key, err).Error())
+				errs = append(errs, fmt.Errorf("%s: %w: %w", key, ErrScriptCompile, err))
+			} else if out := program.Node().Type(); variable.DataType != "" && !variable.DataType.acceptsScriptType(out) {
+				errs = append(errs, fmt.Errorf("%s: %w: script returns %s, declared %s", key, ErrScriptType, out, variable.DataType))
 			} else {
 				variable.Program = program
 			}
 		}
 	}
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+		return fmt.Errorf("Variable errors:\n%w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// MarshalCompressed serializes the model as gzip-compressed JSON
+func (m *DeviceModel) MarshalCompressed() ([]byte, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalCompressed decodes a model serialized by MarshalCompressed
+func UnmarshalCompressed(data []byte) (*DeviceModel, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var m DeviceModel
+	if err := json.NewDecoder(zr).Decode(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// CompileScript compiles a script against the model's variable caches without storing the program
+func (m *DeviceModel) CompileScript(script string) (*vm.Program, error) {
+	return expr.Compile(script, ScriptOptions(m.EnvSnapshot())...)
+}
+
+// WriteValues writes commanded engineering values to several variables together. Each value is encoded
+// as by EncodeForWrite, recorded as the variable's last write and stored in its cache; read-side MinInterval
+// and alarms do not apply. Every target is checked to exist, be enabled and writable, not be within
+// MinInterval of its previous write and accept its value before anything is written, so an invalid
+// batch writes nothing. t defaults to now when nil.
+func (m *DeviceModel) WriteValues(values map[string]any, t *time.Time) error {
+	if t == nil {
+		now := time.Now()
+		t = &now
+	}
+
+	type pendingWrite struct {
+		variable *Variable
+		value    any
+		store    func(t *time.Time, alarms bool)
+	}
+	var errs []string
+	pending := make([]pendingWrite, 0, len(values))
+	for key, value := range values {
+		variable, ok := m.Variables[key]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s: variable not found", key))
+			continue
+		}
+		if variable.IsCalculated() {
+			errs = append(errs, fmt.Sprintf("%s: variable is calculated by a script and cannot be written", key))
+			continue
+		}
+		if !variable.Writable {
+			errs = append(errs, fmt.Sprintf("%s: variable is not writable", key))
+			continue
+		}
+		if !variable.IsEnabled() {
+			errs = append(errs, fmt.Sprintf("%s: variable is disabled", key))
+			continue
+		}
+		if variable.writeTooSoon(*t) {
+			errs = append(errs, fmt.Sprintf("%s: write throttled, within min_interval %v of the previous write", key, *variable.MinInterval))
+			continue
+		}
+		encoded, err := variable.encodeForWrite(value)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", key, err))
+			continue
+		}
+		// 缓存中保存设备值按读取路径换算后的结果，与之后的设备读数一致
+		store, err := variable.prepareWrite(encoded)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", key, err))
+			continue
+		}
+		pending = append(pending, pendingWrite{variable: variable, value: value, store: store})
+	}
 	if len(errs) > 0 {
 		sort.Strings(errs)
-		return fmt.Errorf("Script errors:\n%s", strings.Join(errs, "\n"))
+		return fmt.Errorf("Write errors:\n%s", strings.Join(errs, "\n"))
 	}
 
+	// 所有值已转换完成，写入不会失败
+	for _, w := range pending {
+		w.store(t, false)
+		w.variable.recordWrite(w.value, t)
+	}
 	return nil
 }
 
+// CommandWrite is the command that writes its payload (variable key to value) via WriteValues
+const CommandWrite = "write"
+
+// HandleCommand executes cmd and reports the outcome. It never returns nil; failures,
+// including unknown commands, are reported with Success false and a descriptive Message.
+// Write values go through WriteValues, so they are encoded as by EncodeForWrite and writes
+// that are throttled, disabled or not writable fail rather than being dropped.
+func (m *DeviceModel) HandleCommand(cmd *Command) *CommandResponse {
+	now := time.Now()
+	if cmd == nil {
+		return &CommandResponse{Message: "command is nil", Timestamp: &now}
+	}
+	resp := &CommandResponse{CommandID: cmd.CommandID, Timestamp: &now}
+	switch cmd.Command {
+	case CommandWrite:
+		if len(cmd.Payload) == 0 {
+			resp.Message = "write command has no values"
+			return resp
+		}
+		if err := m.WriteValues(cmd.Payload, cmd.Timestamp); err != nil {
+			resp.Message = err.Error()
+			return resp
+		}
+		resp.Success = true
+	default:
+		resp.Message = fmt.Sprintf("unsupported command %q", cmd.Command)
+	}
+	return resp
+}
+
+// runScript runs program against env, converting a panic into an error naming the variable
+// so one bad script cannot take down the evaluation loop. The expr VM already recovers panics
+// raised while executing instructions; this also covers anything escaping it.
+func runScript(key string, program *vm.Program, env map[string]any) (out any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			out, err = nil, fmt.Errorf("script %s panicked: %v", key, r)
+		}
+	}()
+	return expr.Run(program, env)
+}
+
+// ReadResult is a variable's value in a ReadAll snapshot
+type ReadResult struct {
+	Value     any        `json:"value"`
+	Changed   bool       `json:"changed"`             // latest two cached values differ; always false for scripts
+	Timestamp *time.Time `json:"timestamp,omitempty"` // time of the latest point, or of evaluation for scripts
+}
+
+// ReadAll reads every variable into one snapshot. Script variables are evaluated against the
+// current env; scripts that fail to run are left out.
+func (m *DeviceModel) ReadAll() map[string]ReadResult {
+	results := make(map[string]ReadResult)
+
+	env := m.EnvSnapshot()
+	now := time.Now()
+	for key, variable := range m.Variables {
+		if variable.Program != nil {
+			out, err := runScript(key, variable.Program, env)
+			if err != nil {
+				continue
+			}
+			results[key] = ReadResult{Value: out, Timestamp: &now}
+			continue
+		}
+		value, ts := variable.Read()
+		if ts == nil {
+			continue
+		}
+		results[key] = ReadResult{Value: value, Changed: variable.PointsChanged(), Timestamp: ts}
+	}
+	return results
+}
+
+// VariableSchema is the flat projection of a variable returned by Schema
+type VariableSchema struct {
+	Key        string `json:"key"`
+	Connection string `json:"connection"`
+	Address    string `json:"address"`
+	DataType   string `json:"data_type"`
+	Unit       string `json:"unit"`
+	Writable   bool   `json:"writable"`
+}
+
+// Schema returns one flat entry per variable, sorted by key, for catalog and integration tools
+func (m *DeviceModel) Schema() []VariableSchema {
+	schema := make([]VariableSchema, 0, len(m.Variables))
+	for key, variable := range m.Variables {
+		schema = append(schema, VariableSchema{
+			Key:        key,
+			Connection: variable.Connection,
+			Address:    variable.Address,
+			DataType:   variable.DataTypeStr,
+			Unit:       variable.Unit,
+			Writable:   variable.Writable,
+		})
+	}
+	sort.Slice(schema, func(i, j int) bool { return schema[i].Key < schema[j].Key })
+	return schema
+}
+
+// GetVariablesByGroup returns the variables whose Group is group, sorted by key
+func (m *DeviceModel) GetVariablesByGroup(group string) []*Variable {
+	variables := []*Variable{}
+	for _, variable := range m.Variables {
+		if variable.Group == group {
+			variables = append(variables, variable)
+		}
+	}
+	sort.Slice(variables, func(i, j int) bool { return variables[i].Key < variables[j].Key })
+	return variables
+}
+
+// PushTickPeriod returns the greatest common divisor of the positive variable PublishCycles, the loop
+// period at which every periodic variable falls on a tick; pass it as gcd to GetPushValues.
+// It returns 0 when no variable has a positive PublishCycle; GetPushValues then only publishes on change,
+// so a scheduler should still pick its own loop period.
+func (m *DeviceModel) PushTickPeriod() time.Duration {
+	var period time.Duration
+	for _, variable := range m.Variables {
+		if variable.PublishCycle == nil || *variable.PublishCycle <= 0 {
+			continue
+		}
+		// 欧几里得算法
+		a, b := period, *variable.PublishCycle
+		for b != 0 {
+			a, b = b, a%b
+		}
+		period = a
+	}
+	return period
+}
+
+// MaxPublishCycle returns the longest variable PublishCycle, after which every periodic variable
+// has published at least once. It returns 0 when no variable has a positive PublishCycle.
+func (m *DeviceModel) MaxPublishCycle() time.Duration {
+	var longest time.Duration
+	for _, variable := range m.Variables {
+		if variable.PublishCycle != nil && *variable.PublishCycle > longest {
+			longest = *variable.PublishCycle
+		}
+	}
+	return longest
+}
+
+// StaleVariables returns the sorted keys of address-backed variables without a point newer than maxAge.
+// Script and disabled variables are not polled and are skipped.
+func (m *DeviceModel) StaleVariables(maxAge string) ([]string, error) {
+	duration, err := time.ParseDuration(maxAge)
+	if err != nil {
+		return nil, errors.New("invalid time window format")
+	}
+
+	stale := []string{}
+	for key, variable := range m.Variables {
+		if variable.Connection == "" || !variable.IsEnabled() {
+			continue
+		}
+		if variable.staleFor(duration) {
+			stale = append(stale, key)
+		}
+	}
+	sort.Strings(stale)
+	return stale, nil
+}
+
+// Health returns the fraction of address-backed variables with a point newer than maxAge,
+// or 1 when the model has none. Disabled variables are skipped as in StaleVariables.
+func (m *DeviceModel) Health(maxAge string) (float64, error) {
+	duration, err := time.ParseDuration(maxAge)
+	if err != nil {
+		return 0, errors.New("invalid time window format")
+	}
+
+	total, fresh := 0, 0
+	for _, variable := range m.Variables {
+		if variable.Connection == "" || !variable.IsEnabled() {
+			continue
+		}
+		total++
+		if !variable.staleFor(duration) {
+			fresh++
+		}
+	}
+	if total == 0 {
+		return 1, nil
+	}
+	return float64(fresh) / float64(total), nil
+}
+
+// EvaluateScriptsPartial runs every compiled script variable against the current env.
+// A failing script does not abort the evaluation: successful results and per-key errors are returned separately.
+// The results are not written back to the variables' caches.
+func (m *DeviceModel) EvaluateScriptsPartial() (map[string]any, map[string]error) {
+	results := make(map[string]any)
+	errs := make(map[string]error)
+
+	env := m.EnvSnapshot()
+	for key, variable := range m.Variables {
+		if variable.Program == nil {
+			continue
+		}
+		out, err := runScript(key, variable.Program, env)
+		if err != nil {
+			errs[key] = err
+			continue
+		}
+		results[key] = out
+	}
+	return results, errs
+}
+
+// CollectTags returns the current value of every AsTag variable. Script tags are evaluated
+// against the current env, others are read from their caches; tags without a value are skipped.
+func (m *DeviceModel) CollectTags() (map[string]string, error) {
+	tags := make(map[string]string)
+	var errs []string
+
+	env := m.EnvSnapshot()
+	for key, variable := range m.Variables {
+		if !variable.AsTag {
+			continue
+		}
+		if variable.Program != nil {
+			out, err := runScript(key, variable.Program, env)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", key, err))
+				continue
+			}
+			str, ok := out.(string)
+			if !ok {
+				errs = append(errs, fmt.Sprintf("%s: script returned %T, expected string", key, out))
+				continue
+			}
+			tags[key] = str
+			continue
+		}
+		if value, ts := variable.Read(); ts != nil {
+			if str, ok := value.(string); ok {
+				tags[key] = str
+			}
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return tags, fmt.Errorf("Tag errors:\n%s", strings.Join(errs, "\n"))
+	}
+	return tags, nil
+}
+
+// EnvSnapshot builds the expr environment mapping variable keys to their live caches,
+// so callers can run their own programs with cache methods against current values.
+// RawCache of KeepRaw variables is available as key_raw unless another variable has that key.
+func (m *DeviceModel) EnvSnapshot() map[string]any {
+	env := make(map[string]any)
+	for key, variable := range m.Variables {
+		if variable.Cache != nil {
+			env[key] = variable.Cache
+		}
+	}
+	// 原始值缓存以 key_raw 暴露，不覆盖同名变量
+	for key, variable := range m.Variables {
+		if _, taken := m.Variables[key+"_raw"]; variable.RawCache != nil && !taken {
+			env[key+"_raw"] = variable.RawCache
+		}
+	}
+	return env
+}
+
 func (m *DeviceModel) Hash() string {
-	hash := md5.New()
+	return m.HashWith(HashAlgorithmMD5)
+}
+
+// HashWith hashes the connections and variables using the given algorithm
+func (m *DeviceModel) HashWith(alg HashAlgorithm) string {
+	return m.hashWith(alg, func(v *Variable) string { return v.HashWith(alg) })
+}
+
+// RuntimeHash hashes the model like Hash, but with each variable's RuntimeHash, so it only changes
+// when data collection is affected. Use Hash for config versioning.
+func (m *DeviceModel) RuntimeHash() string {
+	return m.hashWith(HashAlgorithmMD5, (*Variable).RuntimeHash)
+}
+
+func (m *DeviceModel) hashWith(alg HashAlgorithm, variableHash func(v *Variable) string) string {
+	hash := newHasher(alg)
 
 	// 对 Connections 排序
 	connKeys := make([]string, 0, len(m.Connections))
@@ -77,6 +515,20 @@ func (m *DeviceModel) Hash() string {
 		hash.Write([]byte(fmt.Sprintf("%s:%s;", k, m.Connections[k])))
 	}
 
+	// 对 ByteOrders 排序
+	orderKeys := make([]string, 0, len(m.ByteOrders))
+	for k := range m.ByteOrders {
+		orderKeys = append(orderKeys, k)
+	}
+	sort.Strings(orderKeys)
+	for _, k := range orderKeys {
+		hash.Write([]byte(fmt.Sprintf("byte_order:%s:%s;", k, m.ByteOrders[k])))
+	}
+
+	if m.DefaultCacheDuration != nil {
+		hash.Write([]byte(fmt.Sprintf("default_cache_duration:%s;", m.DefaultCacheDuration.String())))
+	}
+
 	// 对 Variables 排序
 	varKeys := make([]string, 0, len(m.Variables))
 	for k := range m.Variables {
@@ -84,7 +536,7 @@ func (m *DeviceModel) Hash() string {
 	}
 	sort.Strings(varKeys)
 	for _, k := range varKeys {
-		varHash := m.Variables[k].Hash()
+		varHash := variableHash(m.Variables[k])
 		hash.Write([]byte(fmt.Sprintf("%s:%s;", k, varHash)))
 	}
 
@@ -1,10 +1,15 @@
 package edgeexpr
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"testing"
 	"time"
+
+	"github.com/expr-lang/expr"
 )
 
 func TestDeviceModel_JSONSerialization(t *testing.T) {
@@ -47,7 +52,7 @@ func TestDeviceModel_JSONSerialization(t *testing.T) {
 	// 创建DeviceModel
 	deviceModel := &DeviceModel{
 		Connections: map[string]string{
-			"plc1": "modbus",
+			"plc1": "s7",
 			"plc2": "ethernet",
 		},
 		Variables: map[string]*Variable{
@@ -74,8 +79,8 @@ func TestDeviceModel_JSONSerialization(t *testing.T) {
 
 		// 检查connections字段
 		if connections, ok := result["connections"].(map[string]interface{}); ok {
-			if connections["plc1"] != "modbus" {
-				t.Errorf("Expected plc1 connection to be 'modbus', got %v", connections["plc1"])
+			if connections["plc1"] != "s7" {
+				t.Errorf("Expected plc1 connection to be 's7', got %v", connections["plc1"])
 			}
 			if connections["plc2"] != "ethernet" {
 				t.Errorf("Expected plc2 connection to be 'ethernet', got %v", connections["plc2"])
@@ -129,8 +134,8 @@ func TestDeviceModel_JSONSerialization(t *testing.T) {
 			t.Errorf("Expected 2 connections, got %d", len(unmarshaledModel.Connections))
 		}
 
-		if unmarshaledModel.Connections["plc1"] != "modbus" {
-			t.Errorf("Expected plc1 connection to be 'modbus', got %v", unmarshaledModel.Connections["plc1"])
+		if unmarshaledModel.Connections["plc1"] != "s7" {
+			t.Errorf("Expected plc1 connection to be 's7', got %v", unmarshaledModel.Connections["plc1"])
 		}
 
 		if len(unmarshaledModel.Variables) != 3 {
@@ -223,7 +228,7 @@ func TestDeviceModel_JSONSerialization(t *testing.T) {
 func TestDeviceModel_UnmarshalJSON_ErrorHandling(t *testing.T) {
 	t.Run("InvalidVariableKey", func(t *testing.T) {
 		jsonStr := `{
-			"connections": {"plc1": "modbus"},
+			"connections": {"plc1": "s7"},
 			"variables": {
 				"invalid-key": {
 					"key": "invalid-key",
@@ -240,14 +245,14 @@ func TestDeviceModel_UnmarshalJSON_ErrorHandling(t *testing.T) {
 			t.Error("Expected error for invalid variable key, but got none")
 		}
 
-		if !contains(err.Error(), "Invalid variable key") {
-			t.Errorf("Expected error message to contain 'Invalid variable key', got: %v", err)
+		if !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Expected ErrInvalidKey, got: %v", err)
 		}
 	})
 
 	t.Run("KeyMismatch", func(t *testing.T) {
 		jsonStr := `{
-			"connections": {"plc1": "modbus"},
+			"connections": {"plc1": "s7"},
 			"variables": {
 				"temperature": {
 					"key": "different_key",
@@ -264,8 +269,47 @@ func TestDeviceModel_UnmarshalJSON_ErrorHandling(t *testing.T) {
 			t.Error("Expected error for key mismatch, but got none")
 		}
 
-		if !contains(err.Error(), "key mismatch") {
-			t.Errorf("Expected error message to contain 'key mismatch', got: %v", err)
+		if !errors.Is(err, ErrKeyMismatch) {
+			t.Errorf("Expected ErrKeyMismatch, got: %v", err)
+		}
+	})
+
+	t.Run("InvalidAddress", func(t *testing.T) {
+		// 地址按所属连接类型校验，错误汇总返回
+		jsonStr := `{
+			"connections": {"plc1": "s7", "plc2": "modbus"},
+			"variables": {
+				"temperature": {
+					"key": "temperature",
+					"connection": "plc1",
+					"address": "DB1.DBD",
+					"data_type": "Float32"
+				},
+				"pressure": {
+					"key": "pressure",
+					"connection": "plc2",
+					"address": "DB1.DBD0",
+					"data_type": "Float32"
+				},
+				"level": {
+					"key": "level",
+					"connection": "plc2",
+					"address": "40001",
+					"data_type": "Word"
+				}
+			}
+		}`
+
+		var deviceModel DeviceModel
+		err := json.Unmarshal([]byte(jsonStr), &deviceModel)
+		if err == nil {
+			t.Fatal("Expected error for invalid addresses, but got none")
+		}
+		if !contains(err.Error(), "variable temperature") || !contains(err.Error(), "variable pressure") {
+			t.Errorf("Expected both invalid variables to be reported, got: %v", err)
+		}
+		if contains(err.Error(), "variable level") {
+			t.Errorf("Expected valid modbus address not to be reported, got: %v", err)
 		}
 	})
 
@@ -287,6 +331,9 @@ func TestDeviceModel_UnmarshalJSON_ErrorHandling(t *testing.T) {
 			t.Error("Expected error for invalid script, but got none")
 		}
 
+		if !errors.Is(err, ErrScriptCompile) {
+			t.Errorf("Expected ErrScriptCompile, got: %v", err)
+		}
 		if !contains(err.Error(), "calculated") {
 			t.Errorf("Expected error message to contain variable name 'calculated', got: %v", err)
 		}
@@ -294,7 +341,7 @@ func TestDeviceModel_UnmarshalJSON_ErrorHandling(t *testing.T) {
 
 	t.Run("ValidJSON", func(t *testing.T) {
 		jsonStr := `{
-			"connections": {"plc1": "modbus"},
+			"connections": {"plc1": "s7"},
 			"variables": {
 				"temperature": {
 					"key": "temperature",
@@ -343,7 +390,7 @@ func TestDeviceModel_Hash(t *testing.T) {
 	createDeviceModel := func() *DeviceModel {
 		return &DeviceModel{
 			Connections: map[string]string{
-				"plc1": "modbus",
+				"plc1": "s7",
 				"plc2": "ethernet",
 			},
 			Variables: map[string]*Variable{
@@ -376,6 +423,50 @@ func TestDeviceModel_Hash(t *testing.T) {
 	}
 }
 
+func TestDeviceModel_HashWith(t *testing.T) {
+	createDeviceModel := func() *DeviceModel {
+		return &DeviceModel{
+			Connections: map[string]string{"plc1": "s7"},
+			Variables: map[string]*Variable{
+				"temp": {
+					Key:         "temp",
+					Connection:  "plc1",
+					Address:     "DB1.DBD0",
+					DataTypeStr: "Float32",
+				},
+			},
+		}
+	}
+
+	model := createDeviceModel()
+
+	md5Hash := model.HashWith(HashAlgorithmMD5)
+	sha256Hash := model.HashWith(HashAlgorithmSHA256)
+
+	// 默认算法保持为 MD5
+	if md5Hash != model.Hash() {
+		t.Errorf("Expected Hash to default to MD5, got %s != %s", model.Hash(), md5Hash)
+	}
+	if len(md5Hash) != 32 {
+		t.Errorf("Expected 32 hex chars for MD5, got %d", len(md5Hash))
+	}
+	if len(sha256Hash) != 64 {
+		t.Errorf("Expected 64 hex chars for SHA-256, got %d", len(sha256Hash))
+	}
+	if md5Hash == sha256Hash {
+		t.Error("Expected different algorithms to produce distinct hashes")
+	}
+
+	// 相同模型的哈希应当稳定
+	if sha256Hash != createDeviceModel().HashWith(HashAlgorithmSHA256) {
+		t.Error("Expected SHA-256 hash to be stable for identical models")
+	}
+
+	if err := HashAlgorithmValidator("crc32"); err == nil {
+		t.Error("Expected error for unsupported hash algorithm")
+	}
+}
+
 func TestDeviceModel_ComplexSerialization(t *testing.T) {
 	// 测试更复杂的JSON序列化/反序列化场景
 	t.Run("EmptyDeviceModel", func(t *testing.T) {
@@ -492,7 +583,7 @@ func TestDeviceModel_ComplexSerialization(t *testing.T) {
 	t.Run("MultipleVariableTypes", func(t *testing.T) {
 		jsonStr := `{
 			"connections": {
-				"plc1": "modbus",
+				"plc1": "s7",
 				"plc2": "ethernet"
 			},
 			"variables": {
@@ -596,7 +687,7 @@ func TestDeviceModel_ComplexSerialization(t *testing.T) {
 		cacheDuration := 1 * time.Minute
 		deviceModel := &DeviceModel{
 			Connections: map[string]string{
-				"plc1": "modbus",
+				"plc1": "s7",
 			},
 			Variables: map[string]*Variable{
 				"temp": {
@@ -631,6 +722,829 @@ func TestDeviceModel_ComplexSerialization(t *testing.T) {
 	})
 }
 
+func TestDeviceModel_CompileScript(t *testing.T) {
+	jsonStr := `{
+		"connections": {"plc1": "s7"},
+		"variables": {
+			"temperature": {
+				"key": "temperature",
+				"connection": "plc1",
+				"address": "DB1.DBD0",
+				"data_type": "Float32"
+			},
+			"running": {
+				"key": "running",
+				"connection": "plc1",
+				"address": "DB1.DBX4.0",
+				"data_type": "Bool"
+			}
+		}
+	}`
+
+	var deviceModel DeviceModel
+	if err := json.Unmarshal([]byte(jsonStr), &deviceModel); err != nil {
+		t.Fatalf("Failed to unmarshal DeviceModel: %v", err)
+	}
+
+	t.Run("ValidScript", func(t *testing.T) {
+		program, err := deviceModel.CompileScript(`running.Value() ? temperature.Value() * 2 : 0`)
+		if err != nil {
+			t.Fatalf("Unexpected error compiling valid script: %v", err)
+		}
+		if program == nil {
+			t.Error("Expected compiled program, got nil")
+		}
+		// 编译不应修改模型
+		if deviceModel.Variables["temperature"].Program != nil {
+			t.Error("CompileScript should not store the program on any variable")
+		}
+	})
+
+	t.Run("InvalidScript", func(t *testing.T) {
+		if _, err := deviceModel.CompileScript(`unknown_var.Value() + 1`); err == nil {
+			t.Error("Expected error for script referencing unknown variable, but got none")
+		}
+	})
+}
+
+func TestDeviceModel_EnvSnapshot(t *testing.T) {
+	jsonStr := `{
+		"connections": {"plc1": "s7"},
+		"variables": {
+			"temperature": {
+				"key": "temperature",
+				"connection": "plc1",
+				"address": "DB1.DBD0",
+				"data_type": "Float32"
+			}
+		}
+	}`
+
+	var deviceModel DeviceModel
+	if err := json.Unmarshal([]byte(jsonStr), &deviceModel); err != nil {
+		t.Fatalf("Failed to unmarshal DeviceModel: %v", err)
+	}
+
+	env := deviceModel.EnvSnapshot()
+	program, err := expr.Compile(`temperature.Value() > 20 && temperature.Len() == 1`, expr.Env(env))
+	if err != nil {
+		t.Fatalf("Failed to compile external expression: %v", err)
+	}
+
+	// 快照持有缓存本身，写入后的新值对快照可见
+	if err := deviceModel.Variables["temperature"].WriteValue(25.0, nil); err != nil {
+		t.Fatalf("Failed to write value: %v", err)
+	}
+
+	out, err := expr.Run(program, env)
+	if err != nil {
+		t.Fatalf("Failed to run external expression: %v", err)
+	}
+	if out != true {
+		t.Errorf("Expected true, got %v", out)
+	}
+}
+
+func TestDeviceModel_EvaluateScriptsPartial(t *testing.T) {
+	jsonStr := `{
+		"connections": {"plc1": "s7"},
+		"variables": {
+			"temperature": {
+				"key": "temperature",
+				"connection": "plc1",
+				"address": "DB1.DBD0",
+				"data_type": "Float32"
+			},
+			"constant": {
+				"key": "constant",
+				"script": "10 + 5",
+				"data_type": "Int32"
+			},
+			"samples": {
+				"key": "samples",
+				"script": "temperature.Len()",
+				"data_type": "Int32"
+			},
+			"average": {
+				"key": "average",
+				"script": "temperature.MA('1m')",
+				"data_type": "Float64"
+			}
+		}
+	}`
+
+	var deviceModel DeviceModel
+	if err := json.Unmarshal([]byte(jsonStr), &deviceModel); err != nil {
+		t.Fatalf("Failed to unmarshal DeviceModel: %v", err)
+	}
+
+	// temperature 缓存为空，average 脚本运行时报错
+	results, errs := deviceModel.EvaluateScriptsPartial()
+
+	if len(errs) != 1 || errs["average"] == nil {
+		t.Errorf("Expected only average to fail, got %v", errs)
+	}
+	if len(results) != 2 {
+		t.Errorf("Expected 2 successful results, got %v", results)
+	}
+	if results["constant"] != 15 {
+		t.Errorf("Expected constant = 15, got %v", results["constant"])
+	}
+	if results["samples"] != 0 {
+		t.Errorf("Expected samples = 0, got %v", results["samples"])
+	}
+}
+
+func TestDeviceModel_DefaultCacheDuration(t *testing.T) {
+	jsonStr := `{
+		"connections": {"plc1": "s7"},
+		"default_cache_duration": "10m",
+		"variables": {
+			"temperature": {
+				"key": "temperature",
+				"connection": "plc1",
+				"address": "DB1.DBD0",
+				"data_type": "Float32"
+			},
+			"running": {
+				"key": "running",
+				"connection": "plc1",
+				"address": "DB1.DBX4.0",
+				"data_type": "Bool",
+				"cache_duration": "30s"
+			}
+		}
+	}`
+
+	var deviceModel DeviceModel
+	if err := json.Unmarshal([]byte(jsonStr), &deviceModel); err != nil {
+		t.Fatalf("Failed to unmarshal DeviceModel: %v", err)
+	}
+
+	if deviceModel.DefaultCacheDuration == nil || *deviceModel.DefaultCacheDuration != 10*time.Minute {
+		t.Fatalf("Expected default cache duration 10m, got %v", deviceModel.DefaultCacheDuration)
+	}
+
+	// 未指定 cache_duration 的变量使用模型默认值
+	if cache := deviceModel.Variables["temperature"].Cache.(*Cache[float64]); cache.ExpireDuration != 10*time.Minute {
+		t.Errorf("Expected temperature cache to expire after 10m, got %v", cache.ExpireDuration)
+	}
+	// 显式指定的 cache_duration 优先
+	if cache := deviceModel.Variables["running"].Cache.(*Cache[bool]); cache.ExpireDuration != 30*time.Second {
+		t.Errorf("Expected running cache to expire after 30s, got %v", cache.ExpireDuration)
+	}
+
+	// 序列化后保留模型默认值
+	jsonData, err := json.Marshal(&deviceModel)
+	if err != nil {
+		t.Fatalf("Failed to marshal DeviceModel: %v", err)
+	}
+	if !contains(string(jsonData), `"default_cache_duration":"10m0s"`) {
+		t.Errorf("Expected default_cache_duration in JSON, got %s", jsonData)
+	}
+}
+
+func TestDeviceModel_WriteValues(t *testing.T) {
+	jsonStr := `{
+		"connections": {"plc1": "s7"},
+		"variables": {
+			"setpoint": {
+				"key": "setpoint",
+				"connection": "plc1",
+				"address": "DB1.DBD0",
+				"data_type": "Float32",
+				"writable": true
+			},
+			"enable": {
+				"key": "enable",
+				"connection": "plc1",
+				"address": "DB1.DBX4.0",
+				"data_type": "Bool",
+				"writable": true
+			},
+			"status": {
+				"key": "status",
+				"connection": "plc1",
+				"address": "DB1.DBX4.1",
+				"data_type": "Bool"
+			},
+			"mask": {
+				"key": "mask",
+				"connection": "plc1",
+				"address": "DB1.DBW6",
+				"data_type": "Word",
+				"writable": true
+			}
+		}
+	}`
+
+	var deviceModel DeviceModel
+	if err := json.Unmarshal([]byte(jsonStr), &deviceModel); err != nil {
+		t.Fatalf("Failed to unmarshal DeviceModel: %v", err)
+	}
+
+	t.Run("AllValid", func(t *testing.T) {
+		err := deviceModel.WriteValues(map[string]any{"setpoint": 42.5, "enable": true}, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if val, _ := deviceModel.Variables["setpoint"].Read(); val != 42.5 {
+			t.Errorf("Expected setpoint 42.5, got %v", val)
+		}
+		if val, _ := deviceModel.Variables["enable"].Read(); val != true {
+			t.Errorf("Expected enable true, got %v", val)
+		}
+	})
+
+	t.Run("OneBadTarget", func(t *testing.T) {
+		err := deviceModel.WriteValues(map[string]any{"setpoint": 50.0, "enable": false, "status": true}, nil)
+		if err == nil {
+			t.Fatal("Expected error for non-writable target")
+		}
+		if !contains(err.Error(), "status") {
+			t.Errorf("Expected error to list the invalid target, got: %v", err)
+		}
+		// 校验失败时不写入任何值
+		if val, _ := deviceModel.Variables["setpoint"].Read(); val != 42.5 {
+			t.Errorf("Expected setpoint to remain 42.5, got %v", val)
+		}
+		if val, _ := deviceModel.Variables["enable"].Read(); val != true {
+			t.Errorf("Expected enable to remain true, got %v", val)
+		}
+	})
+
+	t.Run("Unconvertible", func(t *testing.T) {
+		err := deviceModel.WriteValues(map[string]any{"setpoint": "abc", "unknown": 1}, nil)
+		if err == nil || !contains(err.Error(), "setpoint") || !contains(err.Error(), "unknown") {
+			t.Errorf("Expected errors for setpoint and unknown, got: %v", err)
+		}
+	})
+
+	t.Run("BytesTarget", func(t *testing.T) {
+		// 字节类型与数值类型使用同一转换路径校验，无效时整批不写入
+		err := deviceModel.WriteValues(map[string]any{"setpoint": 60.0, "mask": true}, nil)
+		if err == nil || !contains(err.Error(), "mask") {
+			t.Fatalf("Expected error for mask, got: %v", err)
+		}
+		if val, _ := deviceModel.Variables["setpoint"].Read(); val != 42.5 {
+			t.Errorf("Expected setpoint to remain 42.5, got %v", val)
+		}
+
+		if err := deviceModel.WriteValues(map[string]any{"setpoint": 60.0, "mask": uint16(0x0102)}, nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if val, _ := deviceModel.Variables["mask"].Read(); !bytes.Equal(val.([]byte), []byte{0x02, 0x01}) {
+			t.Errorf("Expected mask bytes 02 01, got %v", val)
+		}
+	})
+}
+
+func TestDeviceModel_WriteValuesEncodesCommands(t *testing.T) {
+	jsonStr := `{
+		"connections": {"plc1": "s7"},
+		"variables": {
+			"level": {
+				"key": "level",
+				"connection": "plc1",
+				"address": "DB1.DBW0",
+				"data_type": "Int16",
+				"scale": 0.1,
+				"offset": 10,
+				"min_interval": "1s",
+				"writable": true,
+				"alarms": [{"type": "hi", "limit": 40}]
+			},
+			"spare": {
+				"key": "spare",
+				"connection": "plc1",
+				"address": "DB1.DBW2",
+				"data_type": "Int16",
+				"writable": true,
+				"enabled": false
+			}
+		}
+	}`
+
+	var deviceModel DeviceModel
+	if err := json.Unmarshal([]byte(jsonStr), &deviceModel); err != nil {
+		t.Fatalf("Failed to unmarshal DeviceModel: %v", err)
+	}
+	level := deviceModel.Variables["level"]
+
+	// 命令值为工程值，不再重复应用 Scale/Offset
+	first := time.Now()
+	if err := deviceModel.WriteValues(map[string]any{"level": 50}, &first); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if val, _ := level.Read(); math.Abs(val.(float64)-50) > 1e-9 {
+		t.Errorf("Expected level 50, got %v", val)
+	}
+	if val, ts := level.LastWritten(); val != 50 || ts == nil || !ts.Equal(first) {
+		t.Errorf("Expected last write 50 at %v, got %v at %v", first, val, ts)
+	}
+	// 命令写入不触发报警
+	if events := level.DrainEvents(); len(events) != 0 {
+		t.Errorf("Expected no alarm events from a command, got %v", events)
+	}
+
+	// 最小间隔内的第二次写入报告失败而不是静默丢弃
+	second := first.Add(100 * time.Millisecond)
+	err := deviceModel.WriteValues(map[string]any{"level": 60}, &second)
+	if err == nil || !contains(err.Error(), "throttled") {
+		t.Errorf("Expected throttled error, got %v", err)
+	}
+	if val, _ := level.LastWritten(); val != 50 {
+		t.Errorf("Expected throttled write not to be recorded, got %v", val)
+	}
+
+	if err := deviceModel.WriteValues(map[string]any{"spare": 1}, nil); err == nil || !contains(err.Error(), "disabled") {
+		t.Errorf("Expected disabled error, got %v", err)
+	}
+}
+
+func TestDeviceModel_HandleCommand(t *testing.T) {
+	jsonStr := `{
+		"connections": {"plc1": "s7"},
+		"variables": {
+			"setpoint": {
+				"key": "setpoint",
+				"connection": "plc1",
+				"address": "DB1.DBD0",
+				"data_type": "Float32",
+				"scale": 0.1,
+				"offset": 10,
+				"min_interval": "1s",
+				"writable": true
+			},
+			"doubled": {
+				"key": "doubled",
+				"script": "setpoint.Value() * 2",
+				"data_type": "Float32",
+				"writable": true
+			}
+		}
+	}`
+
+	var deviceModel DeviceModel
+	if err := json.Unmarshal([]byte(jsonStr), &deviceModel); err != nil {
+		t.Fatalf("Failed to unmarshal DeviceModel: %v", err)
+	}
+
+	t.Run("Write", func(t *testing.T) {
+		resp := deviceModel.HandleCommand(&Command{CommandID: "cmd-1", Command: CommandWrite, Payload: map[string]any{"setpoint": 10.0}})
+		if !resp.Success || resp.CommandID != "cmd-1" {
+			t.Fatalf("Expected successful response for cmd-1, got %+v", resp)
+		}
+		if val, _ := deviceModel.Variables["setpoint"].Read(); val != 10.0 {
+			t.Errorf("Expected setpoint 10, got %v", val)
+		}
+	})
+
+	t.Run("EncodedOnce", func(t *testing.T) {
+		// 命令值经 EncodeForWrite 反向换算一次：(50 - 10) / 0.1 = 400，读回 50
+		ts := time.Now().Add(5 * time.Second)
+		resp := deviceModel.HandleCommand(&Command{CommandID: "cmd-4", Command: CommandWrite, Payload: map[string]any{"setpoint": 50.0}, Timestamp: &ts})
+		if !resp.Success {
+			t.Fatalf("Expected success, got %+v", resp)
+		}
+		setpoint := deviceModel.Variables["setpoint"]
+		if val, _ := setpoint.Read(); math.Abs(val.(float64)-50) > 1e-6 {
+			t.Errorf("Expected setpoint 50, got %v", val)
+		}
+		if val, _ := setpoint.LastWritten(); val != 50.0 {
+			t.Errorf("Expected LastWrite 50, got %v", val)
+		}
+
+		// 最小间隔内的命令报告失败
+		soon := ts.Add(100 * time.Millisecond)
+		resp = deviceModel.HandleCommand(&Command{CommandID: "cmd-5", Command: CommandWrite, Payload: map[string]any{"setpoint": 60.0}, Timestamp: &soon})
+		if resp.Success || !contains(resp.Message, "throttled") {
+			t.Errorf("Expected throttled failure, got %+v", resp)
+		}
+		if val, _ := setpoint.LastWritten(); val != 50.0 {
+			t.Errorf("Expected throttled command not to be recorded, got %v", val)
+		}
+	})
+
+	t.Run("CalculatedVariable", func(t *testing.T) {
+		// 即使标记为可写，脚本计算变量也不能被写入
+		resp := deviceModel.HandleCommand(&Command{CommandID: "cmd-2", Command: CommandWrite, Payload: map[string]any{"doubled": 5.0}})
+		if resp.Success {
+			t.Fatal("Expected write to a calculated variable to fail")
+		}
+		if !contains(resp.Message, "doubled") || !contains(resp.Message, "calculated by a script") {
+			t.Errorf("Expected descriptive failure naming doubled, got: %s", resp.Message)
+		}
+		if val, _ := deviceModel.Variables["doubled"].Read(); val == 5.0 {
+			t.Errorf("Expected doubled to remain unwritten, got %v", val)
+		}
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		resp := deviceModel.HandleCommand(&Command{CommandID: "cmd-3", Command: "reboot"})
+		if resp.Success || !contains(resp.Message, "reboot") {
+			t.Errorf("Expected unsupported command failure, got %+v", resp)
+		}
+	})
+}
+
+func TestDeviceModel_PushTickPeriod(t *testing.T) {
+	jsonStr := `{
+		"connections": {"plc1": "s7"},
+		"variables": {
+			"fast": {"key": "fast", "connection": "plc1", "address": "DB1.DBD0", "data_type": "Float32", "publish_cycle": "1500ms"},
+			"medium": {"key": "medium", "connection": "plc1", "address": "DB1.DBD4", "data_type": "Float32", "publish_cycle": "2s"},
+			"slow": {"key": "slow", "connection": "plc1", "address": "DB1.DBD8", "data_type": "Float32", "publish_cycle": "1m"},
+			"on_change": {"key": "on_change", "connection": "plc1", "address": "DB1.DBD12", "data_type": "Float32", "publish_cycle": "0s"},
+			"unpublished": {"key": "unpublished", "connection": "plc1", "address": "DB1.DBD16", "data_type": "Float32"}
+		}
+	}`
+
+	var deviceModel DeviceModel
+	if err := json.Unmarshal([]byte(jsonStr), &deviceModel); err != nil {
+		t.Fatalf("Failed to unmarshal DeviceModel: %v", err)
+	}
+
+	// 按变化发布和未发布的变量不影响周期
+	if period := deviceModel.PushTickPeriod(); period != 500*time.Millisecond {
+		t.Errorf("Expected tick period 500ms, got %v", period)
+	}
+	if longest := deviceModel.MaxPublishCycle(); longest != time.Minute {
+		t.Errorf("Expected max publish cycle 1m, got %v", longest)
+	}
+
+	var empty DeviceModel
+	if empty.PushTickPeriod() != 0 || empty.MaxPublishCycle() != 0 {
+		t.Error("Expected 0 for a model without periodic variables")
+	}
+}
+
+func TestDeviceModel_PushTickPeriodOnChangeOnly(t *testing.T) {
+	jsonStr := `{
+		"connections": {"plc1": "s7"},
+		"variables": {
+			"cached": {"key": "cached", "connection": "plc1", "address": "DB1.DBD0", "data_type": "Float32", "cache_duration": "1m"},
+			"on_change": {"key": "on_change", "connection": "plc1", "address": "DB1.DBD4", "data_type": "Float32", "publish_cycle": "0s"}
+		}
+	}`
+
+	var deviceModel DeviceModel
+	if err := json.Unmarshal([]byte(jsonStr), &deviceModel); err != nil {
+		t.Fatalf("Failed to unmarshal DeviceModel: %v", err)
+	}
+	gcd := int64(deviceModel.PushTickPeriod())
+	if gcd != 0 {
+		t.Fatalf("Expected tick period 0 for an on-change model, got %v", time.Duration(gcd))
+	}
+
+	// gcd 为 0 时不能除零，按变化发布仍然生效
+	for key, variable := range deviceModel.Variables {
+		variable.WriteValue(1.0, nil)
+		if pushValues := variable.GetPushValues(gcd, 0); len(pushValues) != 1 {
+			t.Errorf("Expected %s to publish its first value, got %d", key, len(pushValues))
+		}
+		if pushValues := variable.GetPushValues(gcd, 1); len(pushValues) != 0 {
+			t.Errorf("Expected %s not to republish an unchanged value, got %d", key, len(pushValues))
+		}
+	}
+}
+
+func TestDeviceModel_CollectTags(t *testing.T) {
+	jsonStr := `{
+		"connections": {"plc1": "s7"},
+		"variables": {
+			"machine_id": {
+				"key": "machine_id",
+				"connection": "plc1",
+				"address": "DB1.DBB0",
+				"data_type": "String",
+				"as_tag": true
+			},
+			"state": {
+				"key": "state",
+				"connection": "plc1",
+				"address": "DB1.DBB10",
+				"data_type": "String"
+			},
+			"label": {
+				"key": "label",
+				"script": "machine_id.Value() + '-' + state.Value()",
+				"data_type": "String",
+				"as_tag": true
+			}
+		}
+	}`
+
+	var deviceModel DeviceModel
+	if err := json.Unmarshal([]byte(jsonStr), &deviceModel); err != nil {
+		t.Fatalf("Failed to unmarshal DeviceModel: %v", err)
+	}
+	deviceModel.Variables["machine_id"].WriteValue("M01", nil)
+	deviceModel.Variables["state"].WriteValue("Run", nil)
+
+	tags, err := deviceModel.CollectTags()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if tags["label"] != "M01-Run" {
+		t.Errorf("Expected label M01-Run, got %q", tags["label"])
+	}
+	if tags["machine_id"] != "M01" {
+		t.Errorf("Expected machine_id M01, got %q", tags["machine_id"])
+	}
+	if _, ok := tags["state"]; ok {
+		t.Error("Expected state not to be collected as a tag")
+	}
+
+	// 非字符串类型的变量不能作为标签
+	bad := `{"key": "x", "script": "1 + 1", "data_type": "Float64", "as_tag": true}`
+	var v Variable
+	if err := json.Unmarshal([]byte(bad), &v); err == nil {
+		t.Error("Expected error for as_tag on a non-string variable")
+	}
+}
+
+func TestDeviceModel_ReadAll(t *testing.T) {
+	jsonStr := `{
+		"connections": {"plc1": "s7"},
+		"variables": {
+			"temperature": {
+				"key": "temperature",
+				"connection": "plc1",
+				"address": "DB1.DBD0",
+				"data_type": "Float32"
+			},
+			"idle": {
+				"key": "idle",
+				"connection": "plc1",
+				"address": "DB1.DBD4",
+				"data_type": "Float32"
+			},
+			"doubled": {
+				"key": "doubled",
+				"script": "temperature.Value() * 2",
+				"data_type": "Float64"
+			}
+		}
+	}`
+
+	var deviceModel DeviceModel
+	if err := json.Unmarshal([]byte(jsonStr), &deviceModel); err != nil {
+		t.Fatalf("Failed to unmarshal DeviceModel: %v", err)
+	}
+	past := time.Now().Add(-time.Second)
+	deviceModel.Variables["temperature"].WriteValue(20.0, &past)
+	deviceModel.Variables["temperature"].WriteValue(21.0, nil)
+
+	results := deviceModel.ReadAll()
+
+	temp, ok := results["temperature"]
+	if !ok {
+		t.Fatal("Expected temperature in snapshot")
+	}
+	if temp.Value != 21.0 || !temp.Changed || temp.Timestamp == nil {
+		t.Errorf("Unexpected temperature result: %+v", temp)
+	}
+
+	doubled, ok := results["doubled"]
+	if !ok {
+		t.Fatal("Expected script variable in snapshot")
+	}
+	if doubled.Value != 42.0 {
+		t.Errorf("Expected doubled 42, got %v", doubled.Value)
+	}
+
+	// 没有数据的变量不包含在快照中
+	if _, ok := results["idle"]; ok {
+		t.Error("Expected variable without data to be omitted")
+	}
+}
+
+func TestDeviceModel_RoundTripKeepsDefaultCacheDurationImplicit(t *testing.T) {
+	jsonStr := `{
+		"connections": {"plc1": "s7"},
+		"variables": {
+			"temperature": {
+				"key": "temperature",
+				"connection": "plc1",
+				"address": "DB1.DBD0",
+				"data_type": "Float32"
+			}
+		}
+	}`
+
+	var original DeviceModel
+	if err := json.Unmarshal([]byte(jsonStr), &original); err != nil {
+		t.Fatalf("Failed to unmarshal DeviceModel: %v", err)
+	}
+	// 默认缓存时长只用于创建缓存，不写回配置
+	if original.Variables["temperature"].CacheDuration != nil {
+		t.Errorf("Expected CacheDuration to stay unset, got %v", original.Variables["temperature"].CacheDuration)
+	}
+
+	data, err := json.Marshal(&original)
+	if err != nil {
+		t.Fatalf("Failed to marshal DeviceModel: %v", err)
+	}
+	if contains(string(data), "cache_duration") {
+		t.Errorf("Expected no cache_duration in round-tripped JSON, got: %s", data)
+	}
+
+	var restored DeviceModel
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatalf("Failed to unmarshal round-tripped DeviceModel: %v", err)
+	}
+	if restored.Hash() != original.Hash() {
+		t.Error("Expected hash to be stable across a round-trip")
+	}
+}
+
+func TestDeviceModel_StaleVariables(t *testing.T) {
+	jsonStr := `{
+		"connections": {"plc1": "s7"},
+		"variables": {
+			"fresh": {
+				"key": "fresh",
+				"connection": "plc1",
+				"address": "DB1.DBD0",
+				"data_type": "Float32"
+			},
+			"stale": {
+				"key": "stale",
+				"connection": "plc1",
+				"address": "DB1.DBD4",
+				"data_type": "Float32"
+			},
+			"calc": {
+				"key": "calc",
+				"script": "fresh.Value() + 1",
+				"data_type": "Float64"
+			}
+		}
+	}`
+
+	var deviceModel DeviceModel
+	if err := json.Unmarshal([]byte(jsonStr), &deviceModel); err != nil {
+		t.Fatalf("Failed to unmarshal DeviceModel: %v", err)
+	}
+	old := time.Now().Add(-30 * time.Second)
+	deviceModel.Variables["stale"].WriteValue(1.0, &old)
+	deviceModel.Variables["fresh"].WriteValue(2.0, nil)
+
+	stale, err := deviceModel.StaleVariables("10s")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(stale) != 1 || stale[0] != "stale" {
+		t.Errorf("Expected [stale], got %v", stale)
+	}
+
+	if _, err := deviceModel.StaleVariables("bad"); err == nil {
+		t.Error("Expected error for invalid duration")
+	}
+}
+
+func TestDeviceModel_ByteOrders(t *testing.T) {
+	jsonStr := `{
+		"connections": {"plc_le": "s7", "plc_be": "s7"},
+		"byte_orders": {"plc_be": "big"},
+		"variables": {
+			"status_le": {
+				"key": "status_le",
+				"connection": "plc_le",
+				"address": "DB1.DBW0",
+				"data_type": "Word",
+				"writable": true
+			},
+			"status_be": {
+				"key": "status_be",
+				"connection": "plc_be",
+				"address": "DB1.DBW0",
+				"data_type": "Word",
+				"writable": true
+			}
+		}
+	}`
+
+	var deviceModel DeviceModel
+	if err := json.Unmarshal([]byte(jsonStr), &deviceModel); err != nil {
+		t.Fatalf("Failed to unmarshal DeviceModel: %v", err)
+	}
+	le := deviceModel.Variables["status_le"]
+	be := deviceModel.Variables["status_be"]
+	if be.ByteOrder != ByteOrderBig || le.ByteOrder != ByteOrderDefault {
+		t.Fatalf("Expected inherited byte orders, got %q and %q", le.ByteOrder, be.ByteOrder)
+	}
+
+	// 相同的字节按不同字节序解码
+	raw := []byte{0x01, 0x02}
+	le.WriteValue(raw, nil)
+	be.WriteValue(raw, nil)
+	if got, err := le.ReadUint(); err != nil || got != 0x0201 {
+		t.Errorf("Expected little-endian 0x0201, got %#x (err: %v)", got, err)
+	}
+	if got, err := be.ReadUint(); err != nil || got != 0x0102 {
+		t.Errorf("Expected big-endian 0x0102, got %#x (err: %v)", got, err)
+	}
+
+	// 数值按连接的字节序编码
+	if encoded, err := be.EncodeForWrite(uint16(0x0102), nil); err != nil || encoded != [2]byte{0x01, 0x02} {
+		t.Errorf("Expected big-endian encoding [1 2], got %v (err: %v)", encoded, err)
+	}
+	if encoded, err := le.EncodeForWrite(uint16(0x0102), nil); err != nil || encoded != [2]byte{0x02, 0x01} {
+		t.Errorf("Expected little-endian encoding [2 1], got %v (err: %v)", encoded, err)
+	}
+
+	var invalid DeviceModel
+	if err := json.Unmarshal([]byte(`{"connections": {"plc1": "s7"}, "byte_orders": {"plc1": "middle"}}`), &invalid); err == nil {
+		t.Error("Expected error for invalid byte order")
+	}
+}
+
+func TestDeviceModel_Health(t *testing.T) {
+	jsonStr := `{
+		"connections": {"plc1": "s7"},
+		"variables": {
+			"a": {"key": "a", "connection": "plc1", "address": "DB1.DBD0", "data_type": "Float32"},
+			"b": {"key": "b", "connection": "plc1", "address": "DB1.DBD4", "data_type": "Float32"},
+			"c": {"key": "c", "connection": "plc1", "address": "DB1.DBD8", "data_type": "Float32"},
+			"d": {"key": "d", "connection": "plc1", "address": "DB1.DBD12", "data_type": "Float32"},
+			"calc": {"key": "calc", "script": "a.Value() + b.Value()", "data_type": "Float64"}
+		}
+	}`
+
+	var deviceModel DeviceModel
+	if err := json.Unmarshal([]byte(jsonStr), &deviceModel); err != nil {
+		t.Fatalf("Failed to unmarshal DeviceModel: %v", err)
+	}
+	old := time.Now().Add(-30 * time.Second)
+	deviceModel.Variables["a"].WriteValue(1.0, nil)
+	deviceModel.Variables["b"].WriteValue(1.0, nil)
+	deviceModel.Variables["c"].WriteValue(1.0, &old)
+
+	// a、b 新鲜，c 过期，d 没有数据；脚本变量不计入
+	health, err := deviceModel.Health("10s")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if health != 0.5 {
+		t.Errorf("Expected health 0.5, got %v", health)
+	}
+
+	empty := &DeviceModel{Variables: map[string]*Variable{}}
+	if health, err := empty.Health("10s"); err != nil || health != 1 {
+		t.Errorf("Expected health 1 for model without address-backed variables, got %v (err: %v)", health, err)
+	}
+	if _, err := deviceModel.Health("bad"); err == nil {
+		t.Error("Expected error for invalid duration")
+	}
+}
+
+func TestDeviceModel_CompressedRoundTrip(t *testing.T) {
+	original := &DeviceModel{
+		Connections: map[string]string{"plc1": "s7"},
+		Variables:   make(map[string]*Variable),
+	}
+	// 构造一个包含大量变量的模型
+	for i := 0; i < 500; i++ {
+		key := fmt.Sprintf("var_%d", i)
+		original.Variables[key] = &Variable{
+			Key:         key,
+			Connection:  "plc1",
+			Address:     fmt.Sprintf("DB1.DBD%d", i*4),
+			DataTypeStr: "Float32",
+			Unit:        "°C",
+		}
+	}
+
+	compressed, err := original.MarshalCompressed()
+	if err != nil {
+		t.Fatalf("MarshalCompressed failed: %v", err)
+	}
+	plain, err := json.Marshal(original)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if len(compressed) >= len(plain) {
+		t.Errorf("Expected compressed size %d to be smaller than JSON size %d", len(compressed), len(plain))
+	}
+
+	restored, err := UnmarshalCompressed(compressed)
+	if err != nil {
+		t.Fatalf("UnmarshalCompressed failed: %v", err)
+	}
+	if len(restored.Variables) != 500 {
+		t.Errorf("Expected 500 variables, got %d", len(restored.Variables))
+	}
+	if restored.Hash() != original.Hash() {
+		t.Error("Expected hash to survive the compressed round-trip")
+	}
+
+	if _, err := UnmarshalCompressed([]byte("not gzip")); err == nil {
+		t.Error("Expected error for invalid compressed data")
+	}
+}
+
 // 辅助函数：检查字符串是否包含子字符串
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (len(substr) == 0 || findSubstring(s, substr))
@@ -644,3 +1558,199 @@ func findSubstring(s, substr string) bool {
 	}
 	return false
 }
+
+func TestDeviceModel_ScriptPanicRecovered(t *testing.T) {
+	jsonStr := `{
+		"connections": {"plc1": "s7"},
+		"variables": {
+			"temperature": {
+				"key": "temperature",
+				"connection": "plc1",
+				"address": "DB1.DBD0",
+				"data_type": "Float32"
+			},
+			"first": {
+				"key": "first",
+				"script": "temperature.Points[0].Value",
+				"data_type": "Float32"
+			}
+		}
+	}`
+
+	var deviceModel DeviceModel
+	if err := json.Unmarshal([]byte(jsonStr), &deviceModel); err != nil {
+		t.Fatalf("Failed to unmarshal DeviceModel: %v", err)
+	}
+
+	// 缓存为空时索引越界，应返回错误而不是 panic
+	_, errs := deviceModel.EvaluateScriptsPartial()
+	if errs["first"] == nil {
+		t.Error("Expected an error for indexing an empty cache")
+	}
+	if _, ok := deviceModel.ReadAll()["first"]; ok {
+		t.Error("Expected failing script to be left out of ReadAll")
+	}
+}
+
+func TestDeviceModel_RuntimeHash(t *testing.T) {
+	scale := 2.0
+	createDeviceModel := func() *DeviceModel {
+		return &DeviceModel{
+			Connections: map[string]string{"plc1": "s7"},
+			Variables: map[string]*Variable{
+				"temp": {
+					Key:         "temp",
+					Connection:  "plc1",
+					Address:     "DB1.DBD0",
+					DataTypeStr: "Float32",
+					Unit:        "°C",
+					Alarms:      []AlarmDef{{Type: AlarmHi, Limit: 80, Message: "Too hot"}},
+				},
+			},
+		}
+	}
+
+	base := createDeviceModel()
+	baseHash, baseRuntime := base.Hash(), base.RuntimeHash()
+
+	// 仅修改展示字段：Hash 变化，RuntimeHash 不变
+	cosmetic := createDeviceModel()
+	cosmetic.Variables["temp"].Unit = "°F"
+	cosmetic.Variables["temp"].Alarms[0].Message = "Overheat"
+	if cosmetic.Hash() == baseHash {
+		t.Error("Expected Hash to change for a unit-only edit")
+	}
+	if cosmetic.RuntimeHash() != baseRuntime {
+		t.Error("Expected RuntimeHash to ignore unit and alarm message edits")
+	}
+
+	// 影响采集的字段会改变 RuntimeHash
+	for name, mutate := range map[string]func(m *DeviceModel){
+		"address":   func(m *DeviceModel) { m.Variables["temp"].Address = "DB1.DBD4" },
+		"data_type": func(m *DeviceModel) { m.Variables["temp"].DataTypeStr = "Float64" },
+		"scale":     func(m *DeviceModel) { m.Variables["temp"].Scale = &scale },
+		"alarm":     func(m *DeviceModel) { m.Variables["temp"].Alarms[0].Limit = 90 },
+	} {
+		m := createDeviceModel()
+		mutate(m)
+		if m.RuntimeHash() == baseRuntime {
+			t.Errorf("Expected RuntimeHash to change when %s changes", name)
+		}
+	}
+}
+
+func TestDeviceModel_ScriptResultTypes(t *testing.T) {
+	jsonStr := `{
+		"connections": {"plc1": "s7"},
+		"variables": {
+			"temperature": {"key": "temperature", "connection": "plc1", "address": "DB1.DBD0", "data_type": "Float32"},
+			"average": {"key": "average", "script": "temperature.MA('1m')", "data_type": "Float64"},
+			"samples": {"key": "samples", "script": "temperature.Len()", "data_type": "Int32"},
+			"hot": {"key": "hot", "script": "temperature.Value() > 80", "data_type": "Bool"},
+			"label": {"key": "label", "script": "temperature.Value() > 80 ? 'hot' : 'ok'", "data_type": "String"},
+			"wrong": {"key": "wrong", "script": "temperature.Value() > 80", "data_type": "Float32"}
+		}
+	}`
+
+	var deviceModel DeviceModel
+	err := json.Unmarshal([]byte(jsonStr), &deviceModel)
+	if !errors.Is(err, ErrScriptType) {
+		t.Fatalf("Expected ErrScriptType, got %v", err)
+	}
+	if !contains(err.Error(), "wrong") {
+		t.Errorf("Expected the mismatched variable to be named, got %v", err)
+	}
+	for _, key := range []string{"average", "samples", "hot", "label"} {
+		if contains(err.Error(), key+":") {
+			t.Errorf("Expected no error for %s, got %v", key, err)
+		}
+	}
+}
+
+func TestDeviceModel_RawCacheInScripts(t *testing.T) {
+	jsonStr := `{
+		"connections": {"plc1": "s7"},
+		"variables": {
+			"pressure": {"key": "pressure", "connection": "plc1", "address": "DB1.DBW0", "data_type": "Int16", "scale": 0.1, "keep_raw": true},
+			"ratio": {"key": "ratio", "script": "pressure.Value() / pressure_raw.Value()", "data_type": "Float64"}
+		}
+	}`
+
+	var deviceModel DeviceModel
+	if err := json.Unmarshal([]byte(jsonStr), &deviceModel); err != nil {
+		t.Fatalf("Failed to unmarshal DeviceModel: %v", err)
+	}
+	deviceModel.Variables["pressure"].WriteValue(250, nil)
+
+	results, errs := deviceModel.EvaluateScriptsPartial()
+	if errs["ratio"] != nil {
+		t.Fatalf("Unexpected error: %v", errs["ratio"])
+	}
+	if math.Abs(results["ratio"].(float64)-0.1) > 1e-9 {
+		t.Errorf("Expected ratio 0.1, got %v", results["ratio"])
+	}
+}
+
+func TestDeviceModel_Schema(t *testing.T) {
+	jsonStr := `{
+		"connections": {"plc1": "s7"},
+		"variables": {
+			"temperature": {"key": "temperature", "connection": "plc1", "address": "DB1.DBD0", "data_type": "Float32", "unit": "°C"},
+			"setpoint": {"key": "setpoint", "connection": "plc1", "address": "DB1.DBD4", "data_type": "Float32", "unit": "°C", "writable": true},
+			"alarm": {"key": "alarm", "script": "temperature.Value() > setpoint.Value()", "data_type": "Bool"}
+		}
+	}`
+	var deviceModel DeviceModel
+	if err := json.Unmarshal([]byte(jsonStr), &deviceModel); err != nil {
+		t.Fatalf("Failed to unmarshal DeviceModel: %v", err)
+	}
+
+	expected := []VariableSchema{
+		{Key: "alarm", DataType: "Bool"},
+		{Key: "setpoint", Connection: "plc1", Address: "DB1.DBD4", DataType: "Float32", Unit: "°C", Writable: true},
+		{Key: "temperature", Connection: "plc1", Address: "DB1.DBD0", DataType: "Float32", Unit: "°C"},
+	}
+	schema := deviceModel.Schema()
+	if len(schema) != len(expected) {
+		t.Fatalf("Expected %d entries, got %d", len(expected), len(schema))
+	}
+	for i := range expected {
+		if schema[i] != expected[i] {
+			t.Errorf("Entry %d: expected %+v, got %+v", i, expected[i], schema[i])
+		}
+	}
+}
+
+func TestDeviceModel_GetVariablesByGroup(t *testing.T) {
+	jsonStr := `{
+		"connections": {"plc1": "s7"},
+		"variables": {
+			"boiler_temp": {"key": "boiler_temp", "connection": "plc1", "address": "DB1.DBD0", "data_type": "Float32", "group": "boiler"},
+			"boiler_pressure": {"key": "boiler_pressure", "connection": "plc1", "address": "DB1.DBD4", "data_type": "Float32", "group": "boiler"},
+			"pump_speed": {"key": "pump_speed", "connection": "plc1", "address": "DB2.DBD0", "data_type": "Float32", "group": "pump"},
+			"ambient": {"key": "ambient", "connection": "plc1", "address": "DB3.DBD0", "data_type": "Float32"}
+		}
+	}`
+	var deviceModel DeviceModel
+	if err := json.Unmarshal([]byte(jsonStr), &deviceModel); err != nil {
+		t.Fatalf("Failed to unmarshal DeviceModel: %v", err)
+	}
+
+	boiler := deviceModel.GetVariablesByGroup("boiler")
+	if len(boiler) != 2 || boiler[0].Key != "boiler_pressure" || boiler[1].Key != "boiler_temp" {
+		t.Errorf("Expected [boiler_pressure boiler_temp], got %v", boiler)
+	}
+	if ungrouped := deviceModel.GetVariablesByGroup(""); len(ungrouped) != 1 || ungrouped[0].Key != "ambient" {
+		t.Errorf("Expected [ambient] without group, got %v", ungrouped)
+	}
+	if none := deviceModel.GetVariablesByGroup("mixer"); len(none) != 0 {
+		t.Errorf("Expected no variables for unknown group, got %v", none)
+	}
+
+	// 分组只影响展示，不改变 RuntimeHash
+	hash, runtime := deviceModel.Hash(), deviceModel.RuntimeHash()
+	deviceModel.Variables["ambient"].Group = "outdoor"
+	if deviceModel.Hash() == hash || deviceModel.RuntimeHash() != runtime {
+		t.Error("Expected group edits to change Hash but not RuntimeHash")
+	}
+}
@@ -1,5 +1,16 @@
 package edgeexpr
 
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
 type Field struct {
 	Key        string `json:"key"`
 	Expression string `json:"expression"`
@@ -7,14 +18,117 @@ type Field struct {
 }
 
 type Event struct {
-	Key        string `json:"key"`
-	Expression string `json:"expression"`
-	Category   string `json:"category,omitempty"` // Optional category for the event
-	Level      int    `json:"level,omitempty"`    // Optional level for the event, e.g., 1 for critical, 2 for warning, etc.
-	Message    string `json:"message,omitempty"`  // Optional message for the event
+	Key           string         `json:"key"`
+	Expression    string         `json:"expression"`
+	Category      string         `json:"category,omitempty"`       // Optional category for the event
+	Level         int            `json:"level,omitempty"`          // Optional level for the event, e.g., 1 for critical, 2 for warning, etc.
+	Message       string         `json:"message,omitempty"`        // Optional message for the event
+	EscalateLevel int            `json:"escalate_level,omitempty"` // Optional level used once escalated, 1 (critical) when unset
+	EscalateAfter *time.Duration `json:"-"`                        // Optional time the condition must hold continuously before escalating
+
+	program *vm.Program // compiled Expression, set on first evaluation
+	since   *time.Time  // when the condition became continuously true, nil while false
+}
+
+func (e *Event) MarshalJSON() ([]byte, error) {
+	type Alias Event
+	aux := &struct {
+		*Alias
+		EscalateAfterStr string `json:"escalate_after,omitempty"`
+	}{
+		Alias: (*Alias)(e),
+	}
+	if e.EscalateAfter != nil {
+		aux.EscalateAfterStr = e.EscalateAfter.String()
+	}
+	return json.Marshal(aux)
+}
+
+func (e *Event) UnmarshalJSON(data []byte) error {
+	type Alias Event
+	aux := &struct {
+		*Alias
+		EscalateAfterStr string `json:"escalate_after"`
+	}{
+		Alias: (*Alias)(e),
+	}
+	if err := json.Unmarshal(data, aux); err != nil {
+		return err
+	}
+	if aux.EscalateAfterStr != "" {
+		duration, err := time.ParseDuration(aux.EscalateAfterStr)
+		if err != nil {
+			return fmt.Errorf("invalid escalate_after format: %v", err)
+		}
+		e.EscalateAfter = &duration
+	}
+	return nil
+}
+
+// Evaluate runs the event expression against env at time now. It returns nil while the condition is false,
+// otherwise a TriggeredEvent whose level is escalated once the condition has held for EscalateAfter.
+func (e *Event) Evaluate(env map[string]any, now time.Time) (*TriggeredEvent, error) {
+	if e.program == nil {
+		program, err := expr.Compile(e.Expression, append(ScriptOptions(env), expr.AsBool())...)
+		if err != nil {
+			return nil, fmt.Errorf("event %s: %w: %w", e.Key, ErrScriptCompile, err)
+		}
+		e.program = program
+	}
+	out, err := runScript(e.Key, e.program, env)
+	if err != nil {
+		return nil, fmt.Errorf("event %s: %v", e.Key, err)
+	}
+	if active, _ := out.(bool); !active {
+		e.since = nil
+		return nil, nil
+	}
+	if e.since == nil {
+		e.since = &now
+	}
+
+	level := e.Level
+	// 条件持续成立超过 EscalateAfter 时升级
+	if e.EscalateAfter != nil && now.Sub(*e.since) >= *e.EscalateAfter {
+		level = e.EscalateLevel
+		if level == 0 {
+			level = 1
+		}
+	}
+	return &TriggeredEvent{
+		Key:       e.Key,
+		Category:  e.Category,
+		Level:     level,
+		Message:   e.Message,
+		Value:     true,
+		Timestamp: &now,
+	}, nil
 }
 
 type EntityModel struct {
 	Fields map[string]*Field `json:"fields"` // map of field name to Field struct
 	Events map[string]*Event `json:"events"` // map of event name to Event struct
 }
+
+// ValidateAgainst compiles every field and event expression against the device model's variables,
+// collecting unresolved identifiers and other compile errors per key. Event expressions must be boolean, as in Evaluate.
+func (m *EntityModel) ValidateAgainst(dm *DeviceModel) error {
+	env := dm.EnvSnapshot()
+
+	var errs []string
+	for key, field := range m.Fields {
+		if _, err := expr.Compile(field.Expression, ScriptOptions(env)...); err != nil {
+			errs = append(errs, fmt.Sprintf("field %s: %v", key, err))
+		}
+	}
+	for key, event := range m.Events {
+		if _, err := expr.Compile(event.Expression, append(ScriptOptions(env), expr.AsBool())...); err != nil {
+			errs = append(errs, fmt.Sprintf("event %s: %v", key, err))
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("Expression errors:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
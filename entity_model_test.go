@@ -0,0 +1,111 @@
+package edgeexpr
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestEntityModel_ValidateAgainst(t *testing.T) {
+	deviceJSON := `{
+		"connections": {"plc1": "s7"},
+		"variables": {
+			"temperature": {
+				"key": "temperature",
+				"connection": "plc1",
+				"address": "DB1.DBD0",
+				"data_type": "Float32"
+			}
+		}
+	}`
+	var deviceModel DeviceModel
+	if err := json.Unmarshal([]byte(deviceJSON), &deviceModel); err != nil {
+		t.Fatalf("Failed to unmarshal DeviceModel: %v", err)
+	}
+
+	entityModel := &EntityModel{
+		Fields: map[string]*Field{
+			"temp_avg": {Key: "temp_avg", Expression: "temperature.MA('1m')"},
+		},
+		Events: map[string]*Event{
+			"overheat": {Key: "overheat", Expression: "temperature.Value() > 80"},
+		},
+	}
+	if err := entityModel.ValidateAgainst(&deviceModel); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// 引用不存在的变量
+	entityModel.Events["overpressure"] = &Event{Key: "overpressure", Expression: "pressure.Value() > 10"}
+	err := entityModel.ValidateAgainst(&deviceModel)
+	if err == nil {
+		t.Fatal("Expected error for unresolved variable")
+	}
+	if !contains(err.Error(), "event overpressure") {
+		t.Errorf("Expected error to name the event, got: %v", err)
+	}
+	if contains(err.Error(), "overheat") {
+		t.Errorf("Expected valid event not to be reported, got: %v", err)
+	}
+
+	// 事件表达式与运行时一样须返回布尔值
+	delete(entityModel.Events, "overpressure")
+	entityModel.Events["level"] = &Event{Key: "level", Expression: "temperature.Value() * 2"}
+	if err := entityModel.ValidateAgainst(&deviceModel); err == nil || !contains(err.Error(), "event level") {
+		t.Errorf("Expected error for non-boolean event expression, got: %v", err)
+	}
+}
+
+func TestEvent_Escalation(t *testing.T) {
+	var event Event
+	if err := json.Unmarshal([]byte(`{
+		"key": "overheat",
+		"expression": "temperature.Value() > 80",
+		"level": 2,
+		"message": "Temperature high",
+		"escalate_after": "5m"
+	}`), &event); err != nil {
+		t.Fatalf("Failed to unmarshal event: %v", err)
+	}
+	if event.EscalateAfter == nil || *event.EscalateAfter != 5*time.Minute {
+		t.Fatalf("Expected escalate_after 5m, got %v", event.EscalateAfter)
+	}
+
+	temperature := NewCache[float64](time.Hour)
+	env := map[string]any{"temperature": temperature}
+	start := time.Now()
+
+	temperature.AddPoint(70, nil)
+	if triggered, err := event.Evaluate(env, start); err != nil || triggered != nil {
+		t.Fatalf("Expected no event below the limit, got %+v (err: %v)", triggered, err)
+	}
+
+	temperature.AddPoint(90, nil)
+	triggered, err := event.Evaluate(env, start.Add(time.Minute))
+	if err != nil || triggered == nil || triggered.Level != 2 {
+		t.Fatalf("Expected warning level 2, got %+v (err: %v)", triggered, err)
+	}
+
+	// 持续超过 5 分钟后升级为严重
+	triggered, err = event.Evaluate(env, start.Add(7*time.Minute))
+	if err != nil || triggered == nil || triggered.Level != 1 {
+		t.Fatalf("Expected escalated level 1, got %+v (err: %v)", triggered, err)
+	}
+
+	// 条件解除后重新计时
+	temperature.AddPoint(70, nil)
+	event.Evaluate(env, start.Add(8*time.Minute))
+	temperature.AddPoint(90, nil)
+	triggered, _ = event.Evaluate(env, start.Add(9*time.Minute))
+	if triggered == nil || triggered.Level != 2 {
+		t.Errorf("Expected level 2 after the condition restarted, got %+v", triggered)
+	}
+
+	data, err := json.Marshal(&event)
+	if err != nil {
+		t.Fatalf("Failed to marshal event: %v", err)
+	}
+	if !contains(string(data), `"escalate_after":"5m0s"`) {
+		t.Errorf("Expected escalate_after in JSON, got %s", data)
+	}
+}
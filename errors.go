@@ -0,0 +1,35 @@
+package edgeexpr
+
+import "errors"
+
+// Sentinel errors for use with errors.Is. Returned errors wrap them and keep their detailed message.
+var (
+	ErrInvalidKey     = errors.New("invalid variable key")
+	ErrKeyMismatch    = errors.New("variable key mismatch")
+	ErrPrecisionLoss  = errors.New("float precision loss")
+	ErrScriptCompile  = errors.New("script compile error")
+	ErrScriptType     = errors.New("script result type mismatch")
+	ErrTypeConversion = errors.New("type conversion error")
+)
+
+// kindError tags err with a sentinel kind without changing its message
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// withKind wraps err so that errors.Is(err, kind) holds; nil stays nil
+func withKind(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: kind, err: err}
+}
@@ -102,6 +102,27 @@ func TestCacheExpr(t *testing.T) {
 		`message.ByteBit(2,4)`,
 		`data.ByteBit(2,4)`,
 		`data.BitAnd(0x1F)`,
+		`temperature.LastN(3)`,
+		`temperature.IsStale('30s')`,
+		`temperature.TWA('20s')`,
+		`temperature.Rate()`,
+		`temperature.RateSince('10s')`,
+		`temperature.Aggregate('max', '20s')`,
+		`temperature.Value() - temperature.Previous()`,
+		`temperature.PreviousN(2)`,
+		`temperature.InRecentRange('10m', 5)`,
+		`temperature.Span('10m')`,
+		`temperature.IsWindowFull('10m')`,
+		`temperature.TimeSinceChange() > duration('1h')`,
+		`len(temperature.DistinctValues('10m'))`,
+		`temperature.AtIndex(-2).Value`,
+		`temperature.SampleCount('10m')`,
+		`temperature.WordAt(0, false)`,
+		`temperature.Mode('10m')`,
+		`temperature.IsFlapping('10m', 5)`,
+		`temperature.AvgInterval('10m')`,
+		`temperature.Summary('10m')`,
+		`temperature.IsFlatlined('10m')`,
 	}
 
 	for _, exprStr := range expressions {
@@ -120,3 +141,31 @@ func TestCacheExpr(t *testing.T) {
 	}
 
 }
+
+func TestScriptHelpers(t *testing.T) {
+	env := map[string]any{
+		"temperature": NewCache[float64](time.Minute),
+	}
+	past := time.Now().Add(-2 * time.Hour)
+	env["temperature"].(*Cache[float64]).AddPoint(23.5, &past)
+
+	program, err := expr.Compile(`now().Sub(temperature.Timestamp()) > duration('1h')`, ScriptOptions(env)...)
+	if err != nil {
+		t.Fatalf("failed to compile expression: %v", err)
+	}
+	out, err := expr.Run(program, env)
+	if err != nil {
+		t.Fatalf("failed to run expression: %v", err)
+	}
+	if out != true {
+		t.Errorf("expected true, got %v", out)
+	}
+
+	program, err = expr.Compile(`duration('abc')`, ScriptOptions(env)...)
+	if err != nil {
+		t.Fatalf("failed to compile expression: %v", err)
+	}
+	if _, err := expr.Run(program, env); err == nil {
+		t.Error("expected runtime error for invalid duration string")
+	}
+}
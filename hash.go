@@ -0,0 +1,36 @@
+package edgeexpr
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+)
+
+// HashAlgorithm selects the digest used by Variable.Hash and DeviceModel.Hash
+type HashAlgorithm string
+
+const (
+	HashAlgorithmMD5    HashAlgorithm = "md5" // default, kept for compatibility with existing hashes
+	HashAlgorithmSHA256 HashAlgorithm = "sha256"
+)
+
+// HashAlgorithmValidator checks that the algorithm is supported
+func HashAlgorithmValidator(alg HashAlgorithm) error {
+	switch alg {
+	case HashAlgorithmMD5, HashAlgorithmSHA256:
+		return nil
+	default:
+		return fmt.Errorf("unsupported hash algorithm: %q", alg)
+	}
+}
+
+// newHasher returns a new hash.Hash for the algorithm, falling back to MD5 for unknown values
+func newHasher(alg HashAlgorithm) hash.Hash {
+	switch alg {
+	case HashAlgorithmSHA256:
+		return sha256.New()
+	default:
+		return md5.New()
+	}
+}
@@ -0,0 +1,105 @@
+package edgeexpr
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/builtin"
+	"github.com/expr-lang/expr/conf"
+)
+
+// FunctionInfo describes a function callable from scripts
+type FunctionInfo struct {
+	Name       string   `json:"name"`
+	Signatures []string `json:"signatures"` // e.g. "func(string) time.Duration", empty when the types are checked at compile time
+	Builtin    bool     `json:"builtin"`    // provided by expr itself rather than registered with RegisterScriptFunction
+}
+
+type scriptFunction struct {
+	fn    func(params ...any) (any, error)
+	types []any
+}
+
+var scriptFunctions = map[string]scriptFunction{}
+
+// MaxScriptNodes limits the number of AST nodes in a script, rejecting overly complex expressions
+// at compile time. It defaults to expr's own limit; 0 disables the check.
+var MaxScriptNodes = conf.DefaultMaxNodes
+
+func init() {
+	RegisterScriptFunction("duration", scriptDuration, new(func(string) time.Duration))
+	RegisterScriptFunction("now", scriptNow, new(func() time.Time))
+}
+
+// RegisterScriptFunction registers (or replaces) a function available to every script.
+// types are function pointers declaring the accepted signatures, as for expr.Function.
+func RegisterScriptFunction(name string, fn func(params ...any) (any, error), types ...any) {
+	scriptFunctions[name] = scriptFunction{fn: fn, types: types}
+}
+
+// ScriptOptions returns the expr options shared by every script compilation path
+func ScriptOptions(env map[string]any) []expr.Option {
+	options := []expr.Option{expr.Env(env), expr.MaxNodes(MaxScriptNodes)}
+	for _, name := range registeredFunctionNames() {
+		f := scriptFunctions[name]
+		options = append(options, expr.Function(name, f.fn, f.types...))
+	}
+	return options
+}
+
+// AvailableFunctions returns the registered script functions followed by the expr built-ins, each in name order
+func AvailableFunctions() []FunctionInfo {
+	functions := make([]FunctionInfo, 0, len(scriptFunctions)+len(builtin.Builtins))
+	for _, name := range registeredFunctionNames() {
+		info := FunctionInfo{Name: name, Signatures: []string{}}
+		for _, t := range scriptFunctions[name].types {
+			info.Signatures = append(info.Signatures, typeString(reflect.TypeOf(t).Elem()))
+		}
+		functions = append(functions, info)
+	}
+
+	builtins := make([]FunctionInfo, 0, len(builtin.Builtins))
+	for _, fn := range builtin.Builtins {
+		// 同名的注册函数会覆盖内置函数
+		if _, ok := scriptFunctions[fn.Name]; ok {
+			continue
+		}
+		info := FunctionInfo{Name: fn.Name, Signatures: []string{}, Builtin: true}
+		for _, t := range fn.Types {
+			info.Signatures = append(info.Signatures, typeString(t))
+		}
+		builtins = append(builtins, info)
+	}
+	sort.Slice(builtins, func(i, j int) bool { return builtins[i].Name < builtins[j].Name })
+	return append(functions, builtins...)
+}
+
+func registeredFunctionNames() []string {
+	names := make([]string, 0, len(scriptFunctions))
+	for name := range scriptFunctions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// duration('1h') parses a Go duration string
+func scriptDuration(params ...any) (any, error) {
+	s, ok := params[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("duration() expects a string, got %T", params[0])
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return nil, fmt.Errorf("duration(): invalid duration %q, expected a format like '30s', '5m' or '1h'", s)
+	}
+	return d, nil
+}
+
+// now() returns the current time
+func scriptNow(params ...any) (any, error) {
+	return time.Now(), nil
+}
@@ -0,0 +1,77 @@
+package edgeexpr
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/expr-lang/expr"
+)
+
+func TestAvailableFunctions(t *testing.T) {
+	RegisterScriptFunction("clamp", func(params ...any) (any, error) {
+		v, lo, hi := params[0].(float64), params[1].(float64), params[2].(float64)
+		return min(max(v, lo), hi), nil
+	}, new(func(float64, float64, float64) float64))
+	defer delete(scriptFunctions, "clamp")
+
+	byName := make(map[string]FunctionInfo)
+	for _, fn := range AvailableFunctions() {
+		byName[fn.Name] = fn
+	}
+
+	clamp, ok := byName["clamp"]
+	if !ok {
+		t.Fatal("Expected registered function clamp in the list")
+	}
+	if clamp.Builtin || len(clamp.Signatures) != 1 || clamp.Signatures[0] != "func(float64, float64, float64) float64" {
+		t.Errorf("Unexpected clamp info: %+v", clamp)
+	}
+	if d := byName["duration"]; d.Builtin || len(d.Signatures) != 1 || !strings.Contains(d.Signatures[0], "time.Duration") {
+		t.Errorf("Unexpected duration info: %+v", d)
+	}
+	if l, ok := byName["len"]; !ok || !l.Builtin {
+		t.Errorf("Expected expr built-in len in the list, got %+v", l)
+	}
+
+	// 注册的函数可在脚本中调用
+	program, err := expr.Compile("clamp(12.0, 0.0, 10.0)", ScriptOptions(map[string]any{})...)
+	if err != nil {
+		t.Fatalf("Failed to compile: %v", err)
+	}
+	if out, err := expr.Run(program, map[string]any{}); err != nil || out != 10.0 {
+		t.Errorf("Expected 10, got %v (err: %v)", out, err)
+	}
+}
+
+func TestMaxScriptNodes(t *testing.T) {
+	model := func(terms int) string {
+		script := "1" + strings.Repeat(" + 1", terms)
+		return `{
+			"connections": {},
+			"variables": {
+				"huge": {"key": "huge", "script": "` + script + `", "data_type": "Int32"}
+			}
+		}`
+	}
+
+	// 2000 项相加仍在默认上限内
+	var deviceModel DeviceModel
+	if err := json.Unmarshal([]byte(model(2000)), &deviceModel); err != nil {
+		t.Errorf("Expected a 2000-term script to compile by default, got %v", err)
+	}
+
+	// 6000 项相加，超出默认节点上限
+	jsonStr := model(6000)
+	err := json.Unmarshal([]byte(jsonStr), &deviceModel)
+	if !errors.Is(err, ErrScriptCompile) {
+		t.Errorf("Expected ErrScriptCompile for oversized script, got %v", err)
+	}
+
+	defer func(n uint) { MaxScriptNodes = n }(MaxScriptNodes)
+	MaxScriptNodes = 0
+	if err := json.Unmarshal([]byte(jsonStr), &deviceModel); err != nil {
+		t.Errorf("Expected no error with the limit disabled, got %v", err)
+	}
+}
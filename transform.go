@@ -0,0 +1,84 @@
+package edgeexpr
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Transform is a nonlinear conversion from raw to engineering value, used instead of Scale/Offset.
+// Exactly one of Polynomial or Table must be set.
+type Transform struct {
+	Polynomial []float64    `json:"polynomial,omitempty"` // Coefficients c0, c1, c2... of c0 + c1*x + c2*x^2 + ...
+	Table      [][2]float64 `json:"table,omitempty"`      // (raw, eng) pairs in ascending raw order, linearly interpolated
+}
+
+// Validate checks that the transform is well formed
+func (t *Transform) Validate() error {
+	switch {
+	case len(t.Polynomial) > 0 && len(t.Table) > 0:
+		return errors.New("transform must set either polynomial or table, not both")
+	case len(t.Polynomial) > 0:
+		return nil
+	case len(t.Table) < 2:
+		return errors.New("transform table needs at least 2 points")
+	}
+	for i := 1; i < len(t.Table); i++ {
+		if t.Table[i][0] <= t.Table[i-1][0] {
+			return fmt.Errorf("transform table raw values must be ascending at index %d", i)
+		}
+	}
+	return nil
+}
+
+// Apply converts a raw value. Table lookups outside the table range are extrapolated from the nearest segment.
+func (t *Transform) Apply(x float64) float64 {
+	if len(t.Polynomial) > 0 {
+		// Horner 法求多项式的值
+		result := 0.0
+		for i := len(t.Polynomial) - 1; i >= 0; i-- {
+			result = result*x + t.Polynomial[i]
+		}
+		return result
+	}
+
+	// 查找 x 所在的区间，超出范围时使用首尾区间外推
+	i := 1
+	for i < len(t.Table)-1 && x > t.Table[i][0] {
+		i++
+	}
+	x0, y0 := t.Table[i-1][0], t.Table[i-1][1]
+	x1, y1 := t.Table[i][0], t.Table[i][1]
+	return y0 + (x-x0)*(y1-y0)/(x1-x0)
+}
+
+// Invert converts an engineering value back to raw, for writes. Only degree-1 polynomials and tables
+// whose engineering values are strictly monotonic can be inverted; outside the table range the nearest
+// segment is extrapolated, as in Apply.
+func (t *Transform) Invert(y float64) (float64, error) {
+	if len(t.Polynomial) > 0 {
+		degree := len(t.Polynomial) - 1
+		for degree > 0 && t.Polynomial[degree] == 0 {
+			degree--
+		}
+		if degree != 1 {
+			return 0, fmt.Errorf("polynomial transform of degree %d cannot be inverted", degree)
+		}
+		return (y - t.Polynomial[0]) / t.Polynomial[1], nil
+	}
+
+	increasing := t.Table[1][1] > t.Table[0][1]
+	for i := 1; i < len(t.Table); i++ {
+		if t.Table[i][1] == t.Table[i-1][1] || (t.Table[i][1] > t.Table[i-1][1]) != increasing {
+			return 0, errors.New("transform table engineering values must be strictly monotonic to invert")
+		}
+	}
+
+	// 按工程值查找区间，超出范围时使用首尾区间外推
+	i := 1
+	for i < len(t.Table)-1 && (increasing && y > t.Table[i][1] || !increasing && y < t.Table[i][1]) {
+		i++
+	}
+	x0, y0 := t.Table[i-1][0], t.Table[i-1][1]
+	x1, y1 := t.Table[i][0], t.Table[i][1]
+	return x0 + (y-y0)*(x1-x0)/(y1-y0), nil
+}
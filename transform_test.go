@@ -0,0 +1,137 @@
+package edgeexpr
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestVariable_PolynomialTransform(t *testing.T) {
+	// 二次多项式：1 + 2x + 0.5x^2
+	jsonStr := `{
+		"key": "temp",
+		"connection": "plc1",
+		"address": "DB1.DBD0",
+		"data_type": "Float32",
+		"scale": 100,
+		"transform": {"polynomial": [1, 2, 0.5]}
+	}`
+	var v Variable
+	if err := json.Unmarshal([]byte(jsonStr), &v); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+
+	if err := v.WriteValue(4, nil); err != nil {
+		t.Fatalf("WriteValue failed: %v", err)
+	}
+	// Transform 存在时忽略 Scale
+	if val, _ := v.Read(); val != 17.0 {
+		t.Errorf("Expected 17, got %v", val)
+	}
+
+	data, err := json.Marshal(&v)
+	if err != nil {
+		t.Fatalf("Failed to marshal variable: %v", err)
+	}
+	var restored Variable
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+	if restored.Transform == nil || len(restored.Transform.Polynomial) != 3 {
+		t.Errorf("Expected transform to round-trip, got %+v", restored.Transform)
+	}
+}
+
+func TestTransform_Table(t *testing.T) {
+	tr := &Transform{Table: [][2]float64{{0, 0}, {10, 100}, {20, 150}}}
+	if err := tr.Validate(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	cases := map[float64]float64{
+		0:  0,
+		5:  50,
+		10: 100,
+		15: 125,
+		20: 150,
+		// 超出范围时按首尾区间外推
+		-5: -50,
+		30: 200,
+	}
+	for raw, expected := range cases {
+		if got := tr.Apply(raw); math.Abs(got-expected) > 1e-9 {
+			t.Errorf("Apply(%v): expected %v, got %v", raw, expected, got)
+		}
+	}
+
+	invalid := []*Transform{
+		{},
+		{Table: [][2]float64{{0, 0}}},
+		{Table: [][2]float64{{10, 0}, {5, 1}}},
+		{Polynomial: []float64{1}, Table: [][2]float64{{0, 0}, {1, 1}}},
+	}
+	for i, tr := range invalid {
+		if err := tr.Validate(); err == nil {
+			t.Errorf("Expected invalid transform %d to fail validation", i)
+		}
+	}
+}
+
+func TestTransform_Invert(t *testing.T) {
+	tables := []*Transform{
+		{Table: [][2]float64{{0, 0}, {10, 100}, {20, 150}}},
+		// 工程值递减的表同样可逆
+		{Table: [][2]float64{{0, 150}, {10, 100}, {20, 0}}},
+		{Polynomial: []float64{5, 2}},
+		{Polynomial: []float64{5, 2, 0}},
+	}
+	for i, tr := range tables {
+		for _, raw := range []float64{-5, 0, 5, 10, 15, 20, 30} {
+			got, err := tr.Invert(tr.Apply(raw))
+			if err != nil || math.Abs(got-raw) > 1e-9 {
+				t.Errorf("transform %d: Invert(Apply(%v)) = %v, %v", i, raw, got, err)
+			}
+		}
+	}
+
+	irreversible := []*Transform{
+		{Polynomial: []float64{1, 2, 0.5}},
+		{Polynomial: []float64{3}},
+		{Table: [][2]float64{{0, 0}, {10, 100}, {20, 50}}},
+		{Table: [][2]float64{{0, 0}, {10, 100}, {20, 100}}},
+	}
+	for i, tr := range irreversible {
+		if _, err := tr.Invert(10); err == nil {
+			t.Errorf("Expected transform %d not to be invertible", i)
+		}
+	}
+}
+
+func TestVariable_EncodeForWriteTransform(t *testing.T) {
+	var v Variable
+	jsonStr := `{
+		"key": "level",
+		"connection": "plc1",
+		"address": "DB1.DBD0",
+		"data_type": "Float32",
+		"writable": true,
+		"scale": 100,
+		"transform": {"table": [[0, 0], [10, 100], [20, 150]]}
+	}`
+	if err := json.Unmarshal([]byte(jsonStr), &v); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+	// 工程值 125 经反向查表得到原始值 15，忽略 Scale
+	encoded, err := v.EncodeForWrite(125.0, nil)
+	if err != nil {
+		t.Fatalf("EncodeForWrite failed: %v", err)
+	}
+	if encoded != float32(15) {
+		t.Errorf("Expected raw 15, got %v (%T)", encoded, encoded)
+	}
+
+	v.Transform = &Transform{Polynomial: []float64{1, 2, 0.5}}
+	if _, err := v.EncodeForWrite(17.0, nil); err == nil {
+		t.Error("Expected error for a transform that cannot be inverted")
+	}
+}
@@ -1,35 +1,72 @@
 package edgeexpr
 
 import (
-	"crypto/md5"
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math"
 	"time"
 
+	"github.com/expr-lang/expr"
 	"github.com/expr-lang/expr/vm"
 )
 
+// ThresholdMode controls how DiffThreshold and PctThreshold combine when both are set
+type ThresholdMode string
+
+const (
+	ThresholdModeDefault ThresholdMode = ""    // DiffThreshold wins when set, otherwise PctThreshold
+	ThresholdModeOr      ThresholdMode = "or"  // publish when either threshold is exceeded
+	ThresholdModeAnd     ThresholdMode = "and" // publish only when both thresholds are exceeded
+)
+
 type Variable struct {
-	Key           string         `json:"key"`
-	Connection    string         `json:"connection"`
-	Address       string         `json:"address"`
-	Script        string         `json:"script"`
-	DiffThreshold *float64       `json:"diff_threshold,omitempty"` // Optional threshold for change detection, in the same unit as the variable
-	PctThreshold  *float64       `json:"pct_threshold,omitempty"`  // Optional percentage threshold for change detection, in the same unit as the variable
-	Scale         *float64       `json:"scale,omitempty"`          // Optional scale factor for the variable value
-	Offset        *float64       `json:"offset,omitempty"`         // Optional offset for the variable value
-	Writable      bool           `json:"writable,omitempty"`       // Optional flag to indicate if the variable is writable
-	DataTypeStr   string         `json:"data_type"`
-	DataType      DataType       `json:"-"`
-	Bytes         int            `json:"-"` // Number of bytes for the data type, derived from DataType
-	PublishCycle  *time.Duration `json:"-"`
-	CacheDuration *time.Duration `json:"-"`
-
-	Cache      any         `json:"-"`
-	LatestPush any         `json:"-"`
-	Program    *vm.Program `json:"-"`
+	Key           string            `json:"key"`
+	Connection    string            `json:"connection"`
+	Address       string            `json:"address"`
+	Script        string            `json:"script"`
+	DiffThreshold *float64          `json:"diff_threshold,omitempty"` // Optional threshold for change detection, in the same unit as the variable
+	PctThreshold  *float64          `json:"pct_threshold,omitempty"`  // Optional percentage threshold for change detection, in the same unit as the variable
+	Scale         *float64          `json:"scale,omitempty"`          // Optional scale factor for the variable value
+	Offset        *float64          `json:"offset,omitempty"`         // Optional offset for the variable value
+	Writable      bool              `json:"writable,omitempty"`       // Optional flag to indicate if the variable is writable
+	ThresholdMode ThresholdMode     `json:"threshold_mode,omitempty"` // Optional combination of DiffThreshold and PctThreshold when both are set
+	Unit          string            `json:"unit,omitempty"`           // Optional engineering unit, e.g. "°C"
+	Min           *float64          `json:"min,omitempty"`            // Optional lower bound of the expected value range
+	Max           *float64          `json:"max,omitempty"`            // Optional upper bound of the expected value range
+	Alarms        []AlarmDef        `json:"alarms,omitempty"`         // Optional limit alarms raising events in WriteValue
+	Transform     *Transform        `json:"transform,omitempty"`      // Optional nonlinear transform applied instead of Scale and Offset
+	Enabled       *bool             `json:"enabled,omitempty"`        // Optional flag to disable polling and publishing, enabled when nil
+	AsTag         bool              `json:"as_tag,omitempty"`         // Optional flag to collect the variable as a string tag, scripts included
+	ValueMap      map[string]string `json:"value_map,omitempty"`      // Optional mapping from raw device values to labels, applied to string variables
+	TimeZone      string            `json:"time_zone,omitempty"`      // Optional IANA zone, e.g. "UTC", used when formatting or exporting timestamps
+	KeepRaw       bool              `json:"keep_raw,omitempty"`       // Optional flag to also cache numeric values before Transform, Scale and Offset in RawCache
+	Group         string            `json:"group,omitempty"`          // Optional subsystem the variable belongs to, for organizing large models
+	DataTypeStr   string            `json:"data_type"`
+	DataType      DataType          `json:"-"`
+	Bytes         int               `json:"-"` // Number of bytes for the data type, derived from DataType
+	PublishCycle  *time.Duration    `json:"-"` // Optional publish interval, 0 publishes on change; see EffectivePublishCycle when unset
+	CacheDuration *time.Duration    `json:"-"`
+	MinInterval   *time.Duration    `json:"-"` // Optional minimum spacing between stored points, unlimited when nil
+	ByteOrder     ByteOrder         `json:"-"` // Byte order inherited from the connection by DeviceModel
+
+	Cache      any              `json:"-"`
+	RawCache   *Cache[float64]  `json:"-"` // Pre-scale values, only with KeepRaw
+	LatestPush any              `json:"-"`
+	LastWrite  *PushValue       `json:"-"` // Last value commanded through EncodeForWrite, separate from device reads
+	Program    *vm.Program      `json:"-"`
+	TimeFunc   func() time.Time `json:"-"` // Optional clock used by WriteValue when no timestamp is given, time.Now when nil
+	// Optional change detection set in code, overrides thresholds in ChangedWithLatestPushValue
+	ChangeFunc func(cache any, latestPush any) bool `json:"-"`
 	// Cache instances can be created externally when needed
 	// This allows the Variable to be non-generic while still supporting caching
+
+	alarmActive []bool                 // whether each alarm in Alarms is currently active
+	events      []TriggeredEvent       // alarm events not yet drained
+	lastRead    any                    // value returned by the previous ReadChanged, nil before the first call
+	predicates  map[string]*vm.Program // predicates compiled by Matches, keyed by text
+	location    *time.Location         // loaded TimeZone, nil until first needed
 }
 
 func (v *Variable) MarshalJSON() ([]byte, error) {
@@ -40,6 +77,7 @@ func (v *Variable) MarshalJSON() ([]byte, error) {
 		*Alias
 		PublishCycleStr  string `json:"publish_cycle,omitempty"`
 		CacheDurationStr string `json:"cache_duration,omitempty"`
+		MinIntervalStr   string `json:"min_interval,omitempty"`
 	}{
 		Alias: (*Alias)(v),
 	}
@@ -54,6 +92,10 @@ func (v *Variable) MarshalJSON() ([]byte, error) {
 		aux.CacheDurationStr = v.CacheDuration.String()
 	}
 
+	if v.MinInterval != nil {
+		aux.MinIntervalStr = v.MinInterval.String()
+	}
+
 	return json.Marshal(aux)
 }
 
@@ -63,17 +105,39 @@ func (v *Variable) UnmarshalJSON(data []byte) error {
 		*Alias
 		PublishCycleStr  string `json:"publish_cycle"`
 		CacheDurationStr string `json:"cache_duration"`
+		MinIntervalStr   string `json:"min_interval"`
 	}{
 		Alias: (*Alias)(v),
 	}
 	if err := json.Unmarshal(data, aux); err != nil {
 		return err
 	}
+	if err := ThresholdModeValidator(v.ThresholdMode); err != nil {
+		return err
+	}
 	var err error
 	v.DataType, v.Bytes, err = ParseDataType(aux.DataTypeStr)
 	if v.Connection != "" && err != nil {
 		return err
 	}
+	for _, alarm := range v.Alarms {
+		if err := AlarmTypeValidator(alarm.Type); err != nil {
+			return fmt.Errorf("variable %s: %v", v.Key, err)
+		}
+	}
+	if v.Transform != nil {
+		if err := v.Transform.Validate(); err != nil {
+			return fmt.Errorf("variable %s: %v", v.Key, err)
+		}
+	}
+	if v.AsTag && v.DataType != DataTypeString {
+		return fmt.Errorf("variable %s: as_tag requires data_type String", v.Key)
+	}
+	if v.TimeZone != "" {
+		if v.location, err = time.LoadLocation(v.TimeZone); err != nil {
+			return fmt.Errorf("variable %s: invalid time_zone: %v", v.Key, err)
+		}
+	}
 
 	// Parse PublishCycle to time.Duration and set publishCycle
 	if aux.PublishCycleStr != "" {
@@ -91,7 +155,29 @@ func (v *Variable) UnmarshalJSON(data []byte) error {
 			return fmt.Errorf("invalid cache format: %v", err)
 		}
 	}
+	if aux.MinIntervalStr != "" {
+		if duration, err := time.ParseDuration(aux.MinIntervalStr); err == nil {
+			v.MinInterval = &duration
+		} else {
+			return fmt.Errorf("invalid min_interval format: %v", err)
+		}
+	}
 	v.Cache = v.createCache() // Create cache instance based on DataType and CacheDuration
+	v.createRawCache()
+	return nil
+}
+
+// Validate checks the data type and address of the variable against the type of its connection
+func (v *Variable) Validate(connType string) error {
+	if v.Connection == "" {
+		return nil
+	}
+	if _, _, err := ParseDataType(v.DataTypeStr); err != nil {
+		return fmt.Errorf("variable %s: %v", v.Key, err)
+	}
+	if _, err := ParseAddress(connType, v.Address); err != nil {
+		return fmt.Errorf("variable %s: %v", v.Key, err)
+	}
 	return nil
 }
 
@@ -100,65 +186,117 @@ func Check[T any](v *T) T {
 }
 
 func (v *Variable) Hash() string {
-	// Implement a hash function to generate a unique identifier for the variable
-	// log.Debugf("Key: %s, Connection: %s, Address: %s, Script: %s, DataTypeStr: %s, Writable: %t", v.Key, v.Connection, v.Address, v.Script, v.DataTypeStr, v.Writable)
-	// if v.DiffThreshold != nil {
-	// 	log.Debugf("DiffThreshold: %0.8f", *v.DiffThreshold)
-	// } else {
-	// 	log.Debugf("DiffThreshold: nil")
-	// }
-	// if v.PctThreshold != nil {
-	// 	log.Debugf("PctThreshold: %0.8f", *v.PctThreshold)
-	// } else {
-	// 	log.Debugf("PctThreshold: nil")
-	// }
-	// if v.Scale != nil {
-	// 	log.Debugf("Scale: %0.8f", *v.Scale)
-	// } else {
-	// 	log.Debugf("Scale: nil")
-	// }
-	// if v.Offset != nil {
-	// 	log.Debugf("Offset: %0.8f", *v.Offset)
-	// } else {
-	// 	log.Debugf("Offset: nil")
-	// }
-	// if v.CacheDuration != nil {
-	// 	log.Debugf("CacheDuration: %s", v.CacheDuration.String())
-	// } else {
-	// 	log.Debugf("CacheDuration: nil")
-	// }
-	// if v.PublishCycle != nil {
-	// 	log.Debugf("PublishCycle: %s", v.PublishCycle.String())
-	// } else {
-	// 	log.Debugf("PublishCycle: nil")
-	// }
+	return v.HashWith(HashAlgorithmMD5)
+}
+
+// HashWith generates a unique identifier for the variable using the given algorithm.
+// The hash is derived from the canonical JSON serialization, so every serialized field contributes.
+func (v *Variable) HashWith(alg HashAlgorithm) string {
+	hash := newHasher(alg)
+	hash.Write(v.canonicalJSON())
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
 
-	hash := md5.New()
-	hash.Write([]byte(v.Key))
-	hash.Write([]byte(v.Connection))
-	hash.Write([]byte(v.Address))
-	hash.Write([]byte(v.Script))
-	hash.Write([]byte(v.DataTypeStr))
-	if v.DiffThreshold != nil {
-		hash.Write([]byte(fmt.Sprintf("%0.8f", *v.DiffThreshold)))
+// canonicalJSON serializes the variable with sorted keys and numbers kept in their JSON text form
+func (v *Variable) canonicalJSON() []byte {
+	return v.canonicalJSONWithout(nil)
+}
+
+// presentationFields are serialized fields that do not affect data collection, skipped by RuntimeHash.
+// Alarm messages are skipped as well.
+var presentationFields = []string{"unit", "min", "max", "group"}
+
+// RuntimeHash hashes only the fields that affect data collection, so edits to presentation fields
+// such as unit, group or alarm messages do not change it. Hash still covers every field.
+func (v *Variable) RuntimeHash() string {
+	hash := newHasher(HashAlgorithmMD5)
+	hash.Write(v.canonicalJSONWithout(func(fields map[string]any) {
+		for _, key := range presentationFields {
+			delete(fields, key)
+		}
+		if alarms, ok := fields["alarms"].([]any); ok {
+			for _, alarm := range alarms {
+				if alarm, ok := alarm.(map[string]any); ok {
+					delete(alarm, "message")
+				}
+			}
+		}
+	}))
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// canonicalJSONWithout is canonicalJSON with the decoded fields passed through strip first, when set.
+// Fields holding NaN or Inf, which JSON cannot represent, are encoded as fixed tokens such as "NaN".
+func (v *Variable) canonicalJSONWithout(strip func(fields map[string]any)) []byte {
+	data, err := json.Marshal(v)
+	var tokens map[string]string
+	if err != nil {
+		var finite *Variable
+		finite, tokens = v.withoutNonFinite()
+		if data, err = json.Marshal(finite); err != nil {
+			return []byte(v.Key)
+		}
 	}
-	if v.PctThreshold != nil {
-		hash.Write([]byte(fmt.Sprintf("%0.8f", *v.PctThreshold)))
+	var fields map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return data
 	}
-	if v.Scale != nil {
-		hash.Write([]byte(fmt.Sprintf("%0.8f", *v.Scale)))
+	for name, token := range tokens {
+		fields[name] = token
 	}
-	if v.Offset != nil {
-		hash.Write([]byte(fmt.Sprintf("%0.8f", *v.Offset)))
+	if strip != nil {
+		strip(fields)
 	}
-	hash.Write([]byte(fmt.Sprintf("%t", v.Writable)))
-	if v.CacheDuration != nil {
-		hash.Write([]byte(v.CacheDuration.String()))
+	// encoding/json 对 map 的键进行排序
+	canonical, err := json.Marshal(fields)
+	if err != nil {
+		return data
 	}
-	if v.PublishCycle != nil {
-		hash.Write([]byte(v.PublishCycle.String()))
+	return canonical
+}
+
+// withoutNonFinite returns a shallow copy of v with the fields holding NaN or Inf cleared, and those
+// fields formatted as tokens keyed by JSON name, e.g. "min": "NaN"
+func (v *Variable) withoutNonFinite() (*Variable, map[string]string) {
+	finite := *v
+	tokens := map[string]string{}
+	nonFinite := func(f float64) bool { return math.IsNaN(f) || math.IsInf(f, 0) }
+	for name, field := range map[string]**float64{
+		"diff_threshold": &finite.DiffThreshold,
+		"pct_threshold":  &finite.PctThreshold,
+		"scale":          &finite.Scale,
+		"offset":         &finite.Offset,
+		"min":            &finite.Min,
+		"max":            &finite.Max,
+	} {
+		if *field != nil && nonFinite(**field) {
+			tokens[name] = fmt.Sprint(**field)
+			*field = nil
+		}
 	}
-	return fmt.Sprintf("%x", hash.Sum(nil))
+	if finite.Transform != nil {
+		values := append([]float64(nil), finite.Transform.Polynomial...)
+		for _, point := range finite.Transform.Table {
+			values = append(values, point[0], point[1])
+		}
+		for _, f := range values {
+			if nonFinite(f) {
+				tokens["transform"] = fmt.Sprint(*finite.Transform)
+				finite.Transform = nil
+				break
+			}
+		}
+	}
+	for _, alarm := range finite.Alarms {
+		if nonFinite(alarm.Limit) {
+			tokens["alarms"] = fmt.Sprint(finite.Alarms)
+			finite.Alarms = nil
+			break
+		}
+	}
+	return &finite, tokens
 }
 
 func (v *Variable) Read() (any, *time.Time) {
@@ -202,112 +340,668 @@ func (v *Variable) Read() (any, *time.Time) {
 	// return nil, nil // Unsupported data type or cache type mismatch
 }
 
-func (v *Variable) ValueUnScale(value interface{}) interface{} {
+// ReadLastGood returns the most recent good value with its timestamp, scanning back through the cache.
+// Zero, NaN and Inf numbers, empty strings and empty byte slices are treated as bad; bool values are always good.
+func (v *Variable) ReadLastGood() (any, *time.Time, bool) {
+	if v.Cache == nil {
+		return nil, nil, false
+	}
+	switch cache := v.Cache.(type) {
+	case *Cache[float64]:
+		if p := cache.lastPointWhere(func(val float64) bool { return val != 0 && !math.IsNaN(val) && !math.IsInf(val, 0) }); p != nil {
+			return p.Value, p.Timestamp, true
+		}
+	case *Cache[bool]:
+		if p := cache.lastPointWhere(func(bool) bool { return true }); p != nil {
+			return p.Value, p.Timestamp, true
+		}
+	case *Cache[string]:
+		if p := cache.lastPointWhere(func(val string) bool { return val != "" }); p != nil {
+			return p.Value, p.Timestamp, true
+		}
+	case *Cache[[]byte]:
+		if p := cache.lastPointWhere(func(val []byte) bool { return len(val) > 0 }); p != nil {
+			return p.Value, p.Timestamp, true
+		}
+	}
+	return nil, nil, false
+}
+
+// ReadChanged returns the latest value with its timestamp and whether it differs from the value returned by
+// the previous ReadChanged call, so consumers polling slower than ingestion see every change. The first read
+// with data reports changed. PointsChanged keeps comparing the latest two cached points.
+func (v *Variable) ReadChanged() (any, bool, *time.Time) {
+	value, ts := v.Read()
+	if ts == nil {
+		return nil, false, nil
+	}
+	changed := true
 	switch val := value.(type) {
 	case float64:
-		if v.Scale != nil && *v.Scale != 0 {
-			val /= *v.Scale
+		last, ok := v.lastRead.(float64)
+		changed = !ok || !isValueEqual(val, last)
+	case bool:
+		last, ok := v.lastRead.(bool)
+		changed = !ok || !isValueEqual(val, last)
+	case string:
+		last, ok := v.lastRead.(string)
+		changed = !ok || !isValueEqual(val, last)
+	case []byte:
+		last, ok := v.lastRead.([]byte)
+		changed = !ok || !isValueEqual(val, last)
+	}
+	v.lastRead = value
+	return value, changed, ts
+}
+
+// Matches reports whether the latest value satisfies predicate, a boolean expression over value,
+// e.g. "value > 10". Compiled predicates are cached by text.
+func (v *Variable) Matches(predicate string) (bool, error) {
+	value, ts := v.Read()
+	if ts == nil {
+		return false, fmt.Errorf("no data yet")
+	}
+	env := map[string]any{"value": value}
+
+	program, ok := v.predicates[predicate]
+	if !ok {
+		var err error
+		program, err = expr.Compile(predicate, expr.Env(env), expr.AsBool())
+		if err != nil {
+			return false, fmt.Errorf("variable %s: %w: %w", v.Key, ErrScriptCompile, err)
 		}
-		if v.Offset != nil {
-			val -= *v.Offset
+		if v.predicates == nil {
+			v.predicates = make(map[string]*vm.Program)
 		}
-		return val
-	case float32:
-		if v.Scale != nil && *v.Scale != 0 {
-			val /= float32(*v.Scale)
+		v.predicates[predicate] = program
+	}
+	out, err := runScript(v.Key, program, env)
+	if err != nil {
+		return false, fmt.Errorf("variable %s: %v", v.Key, err)
+	}
+	return out.(bool), nil
+}
+
+// ReadRaw returns the latest value before Transform, Scale and Offset with its timestamp,
+// or nil when KeepRaw is off or nothing was written yet
+func (v *Variable) ReadRaw() (any, *time.Time) {
+	if v.RawCache == nil || v.RawCache.Len() == 0 {
+		return nil, nil
+	}
+	return v.RawCache.Value(), v.RawCache.Timestamp()
+}
+
+// ReadTyped returns the latest value converted to the variable's declared type, e.g. int16 for Int16,
+// with its timestamp. ok is false when there is no data or the cached value cannot be converted.
+func (v *Variable) ReadTyped() (any, bool, *time.Time) {
+	value, ts := v.Read()
+	if ts == nil {
+		return nil, false, nil
+	}
+	typed, err := v.DataType.ConvertFromAny(value)
+	if err != nil {
+		return nil, false, ts
+	}
+	return typed, true, ts
+}
+
+// ThresholdModeValidator checks the threshold mode enum values
+func ThresholdModeValidator(mode ThresholdMode) error {
+	switch mode {
+	case ThresholdModeDefault, ThresholdModeOr, ThresholdModeAnd:
+		return nil
+	default:
+		return fmt.Errorf("invalid threshold mode: %q", mode)
+	}
+}
+
+// FloatCache returns the cache of a numeric variable
+func (v *Variable) FloatCache() (*Cache[float64], bool) {
+	if !v.DataType.isNumeric() {
+		return nil, false
+	}
+	cache, ok := v.Cache.(*Cache[float64])
+	return cache, ok && cache != nil
+}
+
+// BoolCache returns the cache of a Bool variable
+func (v *Variable) BoolCache() (*Cache[bool], bool) {
+	if v.DataType != DataTypeBool {
+		return nil, false
+	}
+	cache, ok := v.Cache.(*Cache[bool])
+	return cache, ok && cache != nil
+}
+
+// StringCache returns the cache of a String variable
+func (v *Variable) StringCache() (*Cache[string], bool) {
+	if v.DataType != DataTypeString {
+		return nil, false
+	}
+	cache, ok := v.Cache.(*Cache[string])
+	return cache, ok && cache != nil
+}
+
+// ByteCache returns the cache of a Byte, Word or DWord variable
+func (v *Variable) ByteCache() (*Cache[[]byte], bool) {
+	if !v.DataType.isBytes() {
+		return nil, false
+	}
+	cache, ok := v.Cache.(*Cache[[]byte])
+	return cache, ok && cache != nil
+}
+
+// ValueUnScale inverts Scale and Offset, converting an engineering value back to raw as (value - Offset) / Scale.
+// Numbers of any type are returned as float64 when Scale or Offset is set; other values are returned unchanged.
+func (v *Variable) ValueUnScale(value interface{}) interface{} {
+	if v.Scale == nil && v.Offset == nil {
+		return value
+	}
+	val, err := ConvertToFloat64(value)
+	if err != nil {
+		return value
+	}
+	if v.Offset != nil {
+		val -= *v.Offset
+	}
+	if v.Scale != nil && *v.Scale != 0 {
+		val /= *v.Scale
+	}
+	return val
+}
+
+// EncodeForWrite converts an operator value into the variable's device representation
+// and records it as the last write. t defaults to now when nil. With a Transform the value is
+// inverted through it, which fails for transforms that cannot be inverted (see Transform.Invert).
+func (v *Variable) EncodeForWrite(value any, t *time.Time) (any, error) {
+	encoded, err := v.encodeForWrite(value)
+	if err != nil {
+		return nil, err
+	}
+	v.recordWrite(value, t)
+	return encoded, nil
+}
+
+// encodeForWrite is EncodeForWrite without recording the write
+func (v *Variable) encodeForWrite(value any) (any, error) {
+	if !v.Writable {
+		return nil, fmt.Errorf("variable %s is not writable", v.Key)
+	}
+	var raw any
+	if v.Transform != nil {
+		eng, err := ConvertToFloat64(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode value for variable %s: %v", v.Key, err)
 		}
-		if v.Offset != nil {
-			val -= float32(*v.Offset)
+		if raw, err = v.Transform.Invert(eng); err != nil {
+			return nil, fmt.Errorf("failed to encode value for variable %s: %v", v.Key, err)
 		}
-		return val
+	} else {
+		raw = v.ValueUnScale(value)
+	}
+	// 反向换算的浮点误差可能使整数略小于目标值，整数类型先四舍五入再截断
+	if f, ok := raw.(float64); ok && v.DataType.isNumeric() && v.DataType != DataTypeFloat32 && v.DataType != DataTypeFloat64 {
+		raw = math.Round(f)
+	}
+	encoded, err := v.convert(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode value for variable %s: %v", v.Key, err)
+	}
+	return encoded, nil
+}
+
+// recordWrite sets LastWrite to value at t, now when nil
+func (v *Variable) recordWrite(value any, t *time.Time) {
+	if t == nil {
+		now := time.Now()
+		t = &now
+	}
+	v.LastWrite = &PushValue{
+		Key:       v.Key,
+		Value:     value,
+		Timestamp: t,
+	}
+}
+
+// writeTooSoon reports whether a command at t arrives within MinInterval after the last recorded write
+func (v *Variable) writeTooSoon(t time.Time) bool {
+	if v.MinInterval == nil || v.LastWrite == nil || v.LastWrite.Timestamp == nil {
+		return false
+	}
+	gap := t.Sub(*v.LastWrite.Timestamp)
+	return gap > 0 && gap < *v.MinInterval
+}
+
+// LastWritten returns the last value commanded through EncodeForWrite and when it was written
+func (v *Variable) LastWritten() (any, *time.Time) {
+	if v.LastWrite == nil {
+		return nil, nil
+	}
+	return v.LastWrite.Value, v.LastWrite.Timestamp
+}
+
+// Changed reports whether the latest value differs from the last published one by more than the
+// thresholds, so drift below DiffThreshold accumulates until it is exceeded. It matches the push
+// decision of ChangedWithLatestPushValue.
+func (v *Variable) Changed() bool {
+	return v.ChangedWithLatestPushValue()
+}
+
+// PointsChanged reports whether the latest two cached values differ, ignoring thresholds
+func (v *Variable) PointsChanged() bool {
+	switch cache := v.Cache.(type) {
+	case *Cache[float64]:
+		return cache.Changed()
+	case *Cache[bool]:
+		return cache.Changed()
+	case *Cache[string]:
+		return cache.Changed()
+	case *Cache[[]byte]:
+		return cache.Changed()
 	default:
-		return value
+		return false
+	}
+}
+
+// staleFor reports whether the cache has no point newer than maxAge
+func (v *Variable) staleFor(maxAge time.Duration) bool {
+	switch cache := v.Cache.(type) {
+	case *Cache[float64]:
+		return cache.staleFor(maxAge)
+	case *Cache[bool]:
+		return cache.staleFor(maxAge)
+	case *Cache[string]:
+		return cache.staleFor(maxAge)
+	case *Cache[[]byte]:
+		return cache.staleFor(maxAge)
+	default:
+		return true
+	}
+}
+
+// IsEnabled reports whether the variable is enabled, which is the default when Enabled is unset
+func (v *Variable) IsEnabled() bool {
+	return v.Enabled == nil || *v.Enabled
+}
+
+// IsCalculated reports whether the variable is computed by its Script rather than read from a connection
+func (v *Variable) IsCalculated() bool {
+	return v.Script != "" && v.Connection == ""
+}
+
+// ExportCSV writes the cached history as key,timestamp,value rows, with timestamps in TimeZone when set
+func (v *Variable) ExportCSV(w io.Writer) error {
+	prefix := []string{v.Key}
+	loc, err := v.timeLocation()
+	if err != nil {
+		return err
+	}
+	switch cache := v.Cache.(type) {
+	case *Cache[float64]:
+		return cache.writeCSV(w, prefix, loc)
+	case *Cache[bool]:
+		return cache.writeCSV(w, prefix, loc)
+	case *Cache[string]:
+		return cache.writeCSV(w, prefix, loc)
+	case *Cache[[]byte]:
+		return cache.writeCSV(w, prefix, loc)
+	default:
+		return fmt.Errorf("variable %s has no cache", v.Key)
+	}
+}
+
+// FormatTimestamp formats t as RFC 3339 in TimeZone, or in t's own location when TimeZone is unset
+func (v *Variable) FormatTimestamp(t time.Time) (string, error) {
+	loc, err := v.timeLocation()
+	if err != nil {
+		return "", err
+	}
+	if loc != nil {
+		t = t.In(loc)
+	}
+	return t.Format(time.RFC3339Nano), nil
+}
+
+// timeLocation returns the location of TimeZone, or nil when unset
+func (v *Variable) timeLocation() (*time.Location, error) {
+	if v.TimeZone == "" {
+		return nil, nil
+	}
+	if v.location == nil || v.location.String() != v.TimeZone {
+		loc, err := time.LoadLocation(v.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("variable %s: invalid time_zone: %v", v.Key, err)
+		}
+		v.location = loc
+	}
+	return v.location, nil
+}
+
+// convert converts value to the variable's data type. Numbers converted to Word/DWord are
+// laid out in the variable's byte order; byte input is taken as already in device order.
+func (v *Variable) convert(value any) (any, error) {
+	out, err := v.DataType.ConvertFromAny(value)
+	if err != nil || v.ByteOrder != ByteOrderBig {
+		return out, err
+	}
+	switch value.(type) {
+	case []byte, [1]byte, [2]byte, [4]byte, string:
+		return out, nil
+	}
+	// ConvertFromAny 按小端排列，大端时反转
+	switch arr := out.(type) {
+	case [2]byte:
+		return [2]byte{arr[1], arr[0]}, nil
+	case [4]byte:
+		return [4]byte{arr[3], arr[2], arr[1], arr[0]}, nil
+	default:
+		return out, nil
+	}
+}
+
+// ReadUint decodes the latest byte value as an unsigned integer in the variable's byte order
+func (v *Variable) ReadUint() (uint64, error) {
+	cache, ok := v.ByteCache()
+	if !ok {
+		return 0, fmt.Errorf("variable %s is not a byte type", v.Key)
+	}
+	if cache.Len() == 0 {
+		return 0, fmt.Errorf("no data yet")
+	}
+	return v.ByteOrder.DecodeUint(cache.Value()), nil
+}
+
+// WriteBit sets or clears bit index of the latest byte value and writes the result back. Bits are numbered
+// from the least significant bit of the first byte, so index 9 is bit 1 of the second byte.
+func (v *Variable) WriteBit(index int, set bool, t *time.Time) error {
+	cache, ok := v.ByteCache()
+	if !ok {
+		return fmt.Errorf("variable %s is not a byte type", v.Key)
+	}
+	if index < 0 || index >= v.Bytes*8 {
+		return fmt.Errorf("bit index %d out of range for variable %s (must be 0-%d)", index, v.Key, v.Bytes*8-1)
+	}
+
+	// 没有数据时从全零开始
+	value := make([]byte, v.Bytes)
+	if cache.Len() > 0 {
+		copy(value, cache.Value())
+	}
+	if set {
+		value[index/8] |= 1 << (index % 8)
+	} else {
+		value[index/8] &^= 1 << (index % 8)
+	}
+	return v.WriteValue(value, t)
+}
+
+// ByteLayout returns the number of bytes the variable occupies in a protocol frame. It re-parses DataTypeStr
+// and errors when the result disagrees with DataType or Bytes, or when the type has no fixed size.
+func (v *Variable) ByteLayout() (int, error) {
+	dt, size, err := ParseDataType(v.DataTypeStr)
+	if err != nil {
+		return 0, fmt.Errorf("variable %s: %v", v.Key, err)
+	}
+	if dt != v.DataType || size != v.Bytes {
+		return 0, fmt.Errorf("variable %s: data type %s (%d bytes) does not match %q", v.Key, v.DataType, v.Bytes, v.DataTypeStr)
+	}
+	if size <= 0 {
+		return 0, fmt.Errorf("variable %s: data type %q has no fixed size", v.Key, v.DataTypeStr)
+	}
+	return size, nil
+}
+
+// scaledFloat converts value to float64, checks the raw value against the range of the declared
+// data type (see ScaleOverflow) and applies Transform or Scale and Offset
+func (v *Variable) scaledFloat(value any) (float64, error) {
+	floatValue, err := ConvertToFloat64(value)
+	if err != nil {
+		return 0, err
+	}
+	if floatValue, err = v.DataType.checkOverflow(floatValue); err != nil {
+		return 0, err
+	}
+	if v.Transform != nil {
+		return v.Transform.Apply(floatValue), nil
 	}
+	if v.Scale != nil {
+		floatValue *= *v.Scale
+	}
+	if v.Offset != nil {
+		floatValue += *v.Offset
+	}
+	return floatValue, nil
 }
 
 func (v *Variable) WriteValue(value any, t *time.Time) error {
+	if !v.IsEnabled() {
+		return nil
+	}
+	store, err := v.prepareWrite(value)
+	if err != nil {
+		return err
+	}
+	if t == nil && v.TimeFunc != nil {
+		now := v.TimeFunc()
+		t = &now
+	}
+	if v.tooSoon(t) {
+		return nil
+	}
+	store(t, true)
+	return nil
+}
+
+// prepareWrite converts a device value as WriteValue stores it and returns a function adding it to the
+// caches at a timestamp, raising alarms when asked. All conversion happens here, so callers can validate
+// several writes before storing any and the returned function cannot fail.
+func (v *Variable) prepareWrite(value any) (func(t *time.Time, alarms bool), error) {
+	var add func(t *time.Time, alarms bool)
 	switch v.DataType {
 	case DataTypeFloat32, DataTypeFloat64, DataTypeInt8, DataTypeUInt8, DataTypeInt16, DataTypeUInt16,
 		DataTypeInt32, DataTypeUInt32, DataTypeInt64, DataTypeUInt64:
-		floatValue, err := ConvertToFloat64(value)
+		floatValue, err := v.scaledFloat(value)
 		if err != nil {
-			return err
-		}
-		if v.Scale != nil {
-			floatValue *= *v.Scale
+			return nil, err
 		}
-		if v.Offset != nil {
-			floatValue += *v.Offset
-		}
-		cache, ok := v.Cache.(*Cache[float64])
+		cache, ok := v.FloatCache()
 		if !ok {
-			return fmt.Errorf("cache type mismatch for variable %s, expected Cache[float64]", v.Key)
+			return nil, fmt.Errorf("cache type mismatch for variable %s, expected Cache[float64]", v.Key)
+		}
+		// scaledFloat 已校验过转换
+		raw, _ := ConvertToFloat64(value)
+		add = func(t *time.Time, alarms bool) {
+			cache.AddPoint(floatValue, t)
+			if v.KeepRaw {
+				if v.RawCache == nil {
+					v.createRawCache()
+				}
+				v.RawCache.AddPoint(raw, t)
+			}
+			if alarms {
+				v.checkAlarms(floatValue, t)
+			}
 		}
-		cache.AddPoint(floatValue, t)
 	case DataTypeBool:
 		boolValue, err := v.DataType.ConvertFromAny(value)
 		if err != nil {
-			return fmt.Errorf("failed to convert value to bool for variable %s: %v", v.Key, err)
+			return nil, fmt.Errorf("failed to convert value to bool for variable %s: %v", v.Key, err)
 		}
-		cache, ok := v.Cache.(*Cache[bool])
+		cache, ok := v.BoolCache()
 		if !ok {
-			return fmt.Errorf("cache type mismatch for variable %s, expected Cache[bool]", v.Key)
+			return nil, fmt.Errorf("cache type mismatch for variable %s, expected Cache[bool]", v.Key)
 		}
-		cache.AddPoint(boolValue.(bool), t)
+		add = func(t *time.Time, _ bool) { cache.AddPoint(boolValue.(bool), t) }
 	case DataTypeString:
 		stringValue, err := v.DataType.ConvertFromAny(value)
 		if err != nil {
-			return fmt.Errorf("failed to convert value to string for variable %s: %v", v.Key, err)
+			return nil, fmt.Errorf("failed to convert value to string for variable %s: %v", v.Key, err)
 		}
-		cache, ok := v.Cache.(*Cache[string])
+		cache, ok := v.StringCache()
 		if !ok {
-			return fmt.Errorf("cache type mismatch for variable %s, expected Cache[string]", v.Key)
+			return nil, fmt.Errorf("cache type mismatch for variable %s, expected Cache[string]", v.Key)
 		}
-		cache.AddPoint(stringValue.(string), t)
-	case DataTypeByte, DataTypeWord, DataTypeDWord:
-		_bytesValue, err := v.DataType.ConvertFromAny(value)
+		mapped := v.mapValue(stringValue.(string))
+		add = func(t *time.Time, _ bool) { cache.AddPoint(mapped, t) }
+	case DataTypeByte, DataTypeWord, DataTypeDWord, DataTypeRaw:
+		_bytesValue, err := v.convert(value)
 		if err != nil {
-			return fmt.Errorf("failed to convert value to bytes for variable %s: %v", v.Key, err)
+			return nil, fmt.Errorf("failed to convert value to bytes for variable %s: %v", v.Key, err)
 		}
 		bytesValue, err := ConvertToBytes(_bytesValue)
 		if err != nil {
-			return fmt.Errorf("failed to convert value to bytes for variable %s: %v", v.Key, err)
+			return nil, fmt.Errorf("failed to convert value to bytes for variable %s: %v", v.Key, err)
 		}
-		cache, ok := v.Cache.(*Cache[[]byte])
+		cache, ok := v.ByteCache()
+		if !ok {
+			return nil, fmt.Errorf("cache type mismatch for variable %s, expected Cache[[]byte]", v.Key)
+		}
+		add = func(t *time.Time, _ bool) { cache.AddPoint(bytesValue, t) }
+	default:
+		return nil, fmt.Errorf("unsupported data type %s for writing value", v.DataType)
+	}
+
+	return add, nil
+}
+
+// WriteValues converts a batch of values, e.g. history backfilled after a reconnect, and inserts them
+// into the cache, and RawCache with KeepRaw, with one AddPoints call. Nothing is written when any value
+// fails to convert. Unlike WriteValue it does not apply MinInterval or raise alarms.
+func (v *Variable) WriteValues(values []PushValue) error {
+	if !v.IsEnabled() || len(values) == 0 {
+		return nil
+	}
+	switch v.DataType {
+	case DataTypeFloat32, DataTypeFloat64, DataTypeInt8, DataTypeUInt8, DataTypeInt16, DataTypeUInt16,
+		DataTypeInt32, DataTypeUInt32, DataTypeInt64, DataTypeUInt64:
+		cache, ok := v.FloatCache()
+		if !ok {
+			return fmt.Errorf("cache type mismatch for variable %s, expected Cache[float64]", v.Key)
+		}
+		if err := writePoints(v, cache, values, v.scaledFloat); err != nil || !v.KeepRaw {
+			return err
+		}
+		if v.RawCache == nil {
+			v.createRawCache()
+		}
+		return writePoints(v, v.RawCache, values, ConvertToFloat64)
+	case DataTypeBool:
+		cache, ok := v.BoolCache()
+		if !ok {
+			return fmt.Errorf("cache type mismatch for variable %s, expected Cache[bool]", v.Key)
+		}
+		return writePoints(v, cache, values, func(value any) (bool, error) {
+			boolValue, err := v.DataType.ConvertFromAny(value)
+			if err != nil {
+				return false, err
+			}
+			return boolValue.(bool), nil
+		})
+	case DataTypeString:
+		cache, ok := v.StringCache()
+		if !ok {
+			return fmt.Errorf("cache type mismatch for variable %s, expected Cache[string]", v.Key)
+		}
+		return writePoints(v, cache, values, func(value any) (string, error) {
+			stringValue, err := v.DataType.ConvertFromAny(value)
+			if err != nil {
+				return "", err
+			}
+			return v.mapValue(stringValue.(string)), nil
+		})
+	case DataTypeByte, DataTypeWord, DataTypeDWord, DataTypeRaw:
+		cache, ok := v.ByteCache()
 		if !ok {
 			return fmt.Errorf("cache type mismatch for variable %s, expected Cache[[]byte]", v.Key)
 		}
-		cache.AddPoint(bytesValue, t)
+		return writePoints(v, cache, values, func(value any) ([]byte, error) {
+			bytesValue, err := v.convert(value)
+			if err != nil {
+				return nil, err
+			}
+			return ConvertToBytes(bytesValue)
+		})
 	default:
 		return fmt.Errorf("unsupported data type %s for writing value", v.DataType)
 	}
+}
+
+// writePoints converts all values with conv before adding any of them to cache
+func writePoints[T float64 | bool | string | []byte](v *Variable, cache *Cache[T], values []PushValue, conv func(any) (T, error)) error {
+	points := make([]Point[T], 0, len(values))
+	for i, pv := range values {
+		value, err := conv(pv.Value)
+		if err != nil {
+			return fmt.Errorf("failed to convert value %d for variable %s: %v", i, v.Key, err)
+		}
+		ts := pv.Timestamp
+		if ts == nil && v.TimeFunc != nil {
+			now := v.TimeFunc()
+			ts = &now
+		}
+		points = append(points, Point[T]{Value: value, Timestamp: ts})
+	}
+	cache.AddPoints(points)
 	return nil
 }
 
+// tooSoon reports whether a point at t arrives within MinInterval after the last stored point.
+// Corrections at the same timestamp and backfilled older points are never throttled.
+func (v *Variable) tooSoon(t *time.Time) bool {
+	if v.MinInterval == nil {
+		return false
+	}
+	_, last := v.Read()
+	if last == nil {
+		return false
+	}
+	ts := time.Now()
+	if t != nil {
+		ts = *t
+	}
+	gap := ts.Sub(*last)
+	return gap > 0 && gap < *v.MinInterval
+}
+
+// mapValue returns the ValueMap label for raw, or raw itself when it is not mapped
+func (v *Variable) mapValue(raw string) string {
+	if label, ok := v.ValueMap[raw]; ok {
+		return label
+	}
+	return raw
+}
+
+// createRawCache creates RawCache with the expiry of the main cache when KeepRaw is set on a numeric variable
+func (v *Variable) createRawCache() {
+	cache, ok := v.FloatCache()
+	if !v.KeepRaw || !ok {
+		v.RawCache = nil
+		return
+	}
+	v.RawCache = NewCache[float64](cache.ExpireDuration)
+}
+
 func (v *Variable) createCache() any {
+	return v.createCacheWithDefault(time.Minute)
+}
+
+// createCacheWithDefault creates the cache using defaultDuration when CacheDuration is unset
+func (v *Variable) createCacheWithDefault(defaultDuration time.Duration) any {
+	duration := defaultDuration
+	if v.CacheDuration != nil {
+		duration = *v.CacheDuration
+	}
 	// 根据 DataType 创建相应类型的缓存
 	switch v.DataType {
 	case DataTypeFloat32, DataTypeFloat64, DataTypeInt8, DataTypeUInt8, DataTypeInt16, DataTypeUInt16,
 		DataTypeInt32, DataTypeUInt32, DataTypeInt64, DataTypeUInt64:
-		if v.CacheDuration != nil {
-			return NewCache[float64](*v.CacheDuration)
-		}
-		return NewCache[float64](time.Minute)
+		return NewCache[float64](duration)
 	case DataTypeBool:
-		if v.CacheDuration != nil {
-			return NewCache[bool](*v.CacheDuration)
-		}
-		return NewCache[bool](time.Minute)
+		return NewCache[bool](duration)
 	case DataTypeString:
-		if v.CacheDuration != nil {
-			return NewCache[string](*v.CacheDuration)
-		}
-		return NewCache[string](time.Minute)
-	case DataTypeByte, DataTypeWord, DataTypeDWord:
-		if v.CacheDuration != nil {
-			return NewCache[[]byte](*v.CacheDuration)
-		}
-		return NewCache[[]byte](time.Minute)
+		return NewCache[string](duration)
+	case DataTypeByte, DataTypeWord, DataTypeDWord, DataTypeRaw:
+		return NewCache[[]byte](duration)
 	default:
 		return nil // Unsupported data type for caching
 	}
@@ -1,66 +1,166 @@
 package edgeexpr
 
 import (
+	"encoding/base64"
+	"fmt"
 	"math"
+	"time"
 
 	"github.com/samber/lo"
 )
 
+// EffectivePublishCycle returns the publish cycle used by GetPushValues and whether the variable publishes at all:
+//   - PublishCycle set: publish every PublishCycle, or on change when it is 0, whatever CacheDuration is
+//   - only CacheDuration set: publish on change, as if PublishCycle were 0
+//   - neither set: the variable is not published
+func (v *Variable) EffectivePublishCycle() (time.Duration, bool) {
+	if v.PublishCycle != nil {
+		return *v.PublishCycle, true
+	}
+	if v.CacheDuration != nil {
+		return 0, true
+	}
+	return 0, false
+}
+
+// GetPushValues returns the values due at tick i of a loop running every gcd nanoseconds.
+// A gcd of 0 or less, as PushTickPeriod returns when no variable publishes periodically,
+// only publishes on change.
 func (v *Variable) GetPushValues(gcd, i int64) []*PushValue {
 	var pushValues []*PushValue
-	if v.PublishCycle == nil {
+	cycle, ok := v.EffectivePublishCycle()
+	if !ok {
 		return pushValues
 	}
-	if v.Cache == nil {
+	if v.Cache == nil || !v.IsEnabled() {
 		return pushValues
 	}
 	// if !v.TimestampUpdated() {
 	// 	return pushValues
 	// }
-	publishCycle := int64(*v.PublishCycle)
-	times := publishCycle / gcd
+	publishCycle := int64(cycle)
+	var times int64
+	// gcd 为 0 时没有周期变量，只按变化发布
+	if gcd > 0 {
+		times = publishCycle / gcd
+	}
 	changed := v.ChangedWithLatestPushValue()
 	if (publishCycle <= 0 && changed) || (times != 0 && i%times == 0) {
 		switch cache := v.Cache.(type) {
 		case *Cache[float64]:
-			if pushValue := cache.PushValue(); pushValue != nil {
+			if latest := cache.Point(); latest != nil {
 				if changed && len(cache.Points) >= 2 {
 					if p, ok := v.LatestPush.(Point[float64]); ok {
-						if p.Timestamp != nil && cache.Points[len(cache.Points)-2].Timestamp != nil && !p.Timestamp.Equal(*cache.Points[len(cache.Points)-2].Timestamp) {
-							pushValues = append(pushValues, &PushValue{
-								// Key:       v.Key,
-								Value:     cache.Points[len(cache.Points)-2].Value,
-								Timestamp: cache.Points[len(cache.Points)-2].Timestamp,
-							})
+						previous := cache.Points[len(cache.Points)-2]
+						if p.Timestamp != nil && previous.Timestamp != nil && !p.Timestamp.Equal(*previous.Timestamp) {
+							pushValues = append(pushValues, NewPushValue(v.Key, previous))
 						}
 					}
 				}
-				pushValues = append(pushValues, pushValue)
-				v.LatestPush = cache.Points[len(cache.Points)-1]
+				pushValues = append(pushValues, NewPushValue(v.Key, *latest))
+				v.LatestPush = *latest
 			}
 		case *Cache[bool]:
-			if pushValue := cache.PushValue(); pushValue != nil {
-				pushValues = append(pushValues, pushValue)
-				v.LatestPush = cache.Points[len(cache.Points)-1]
+			if latest := cache.Point(); latest != nil {
+				pushValues = append(pushValues, NewPushValue(v.Key, *latest))
+				v.LatestPush = *latest
 			}
 		case *Cache[string]:
-			if pushValue := cache.PushValue(); pushValue != nil {
-				pushValues = append(pushValues, pushValue)
-				v.LatestPush = cache.Points[len(cache.Points)-1]
+			if latest := cache.Point(); latest != nil {
+				pushValues = append(pushValues, NewPushValue(v.Key, *latest))
+				v.LatestPush = *latest
 			}
 		case *Cache[[]byte]:
-			if pushValue := cache.PushValue(); pushValue != nil {
-				pushValues = append(pushValues, pushValue)
-				v.LatestPush = cache.Points[len(cache.Points)-1]
+			if latest := cache.Point(); latest != nil {
+				pushValues = append(pushValues, NewPushValue(v.Key, *latest))
+				v.LatestPush = *latest
 			}
 			// Supported cache types
 		default:
 			// Unsupported cache type
 		}
 	}
+	for _, pv := range pushValues {
+		pv.DataType = v.DataType.String()
+		pv.Unit = v.Unit
+	}
 	return pushValues
 }
 
+// VariableState is the persistable runtime state of a variable, so change detection survives restarts
+type VariableState struct {
+	Key        string     `json:"key"`
+	LatestPush *PushValue `json:"latest_push,omitempty"` // nil before the first push
+}
+
+// ExportState captures the variable's runtime state for ImportState
+func (v *Variable) ExportState() VariableState {
+	state := VariableState{Key: v.Key}
+	switch p := v.LatestPush.(type) {
+	case Point[float64]:
+		state.LatestPush = NewPushValue(v.Key, p)
+	case Point[bool]:
+		state.LatestPush = NewPushValue(v.Key, p)
+	case Point[string]:
+		state.LatestPush = NewPushValue(v.Key, p)
+	case Point[[]byte]:
+		state.LatestPush = NewPushValue(v.Key, p)
+	}
+	return state
+}
+
+// ImportState restores state captured by ExportState, typing the latest push for the variable's cache.
+// It accepts state decoded from JSON, where numbers arrive as float64 and bytes as base64 strings.
+func (v *Variable) ImportState(state VariableState) error {
+	if state.Key != "" && state.Key != v.Key {
+		return fmt.Errorf("variable %s: state belongs to %s", v.Key, state.Key)
+	}
+	if state.LatestPush == nil {
+		v.LatestPush = nil
+		return nil
+	}
+	value, ts := state.LatestPush.Value, state.LatestPush.Timestamp
+	switch v.Cache.(type) {
+	case *Cache[float64]:
+		f, err := ConvertToFloat64(value)
+		if err != nil {
+			return fmt.Errorf("variable %s: %v", v.Key, err)
+		}
+		v.LatestPush = Point[float64]{Value: f, Timestamp: ts}
+	case *Cache[bool]:
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("variable %s: value is not a bool type", v.Key)
+		}
+		v.LatestPush = Point[bool]{Value: b, Timestamp: ts}
+	case *Cache[string]:
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("variable %s: value is not a string type", v.Key)
+		}
+		v.LatestPush = Point[string]{Value: str, Timestamp: ts}
+	case *Cache[[]byte]:
+		var data []byte
+		switch b := value.(type) {
+		case []byte:
+			data = append([]byte(nil), b...)
+		case string:
+			// encoding/json 将 []byte 编码为 base64 字符串
+			decoded, err := base64.StdEncoding.DecodeString(b)
+			if err != nil {
+				return fmt.Errorf("variable %s: invalid base64 bytes: %v", v.Key, err)
+			}
+			data = decoded
+		default:
+			return fmt.Errorf("variable %s: value is not a []byte type", v.Key)
+		}
+		v.LatestPush = Point[[]byte]{Value: data, Timestamp: ts}
+	default:
+		return fmt.Errorf("variable %s: cache is nil", v.Key)
+	}
+	return nil
+}
+
 func (v *Variable) TimestampUpdated() bool {
 	if v.Cache == nil {
 		return false
@@ -99,10 +199,15 @@ func (v *Variable) TimestampUpdated() bool {
 	}
 }
 
+// ChangedWithLatestPushValue reports whether the cache differs enough from the latest push to publish.
+// When ChangeFunc is set it decides instead, receiving the cache and the latest pushed point (nil before the first push).
 func (v *Variable) ChangedWithLatestPushValue() bool {
 	if v.Cache == nil {
 		return false
 	}
+	if v.ChangeFunc != nil {
+		return v.ChangeFunc(v.Cache, v.LatestPush)
+	}
 	if v.LatestPush == nil {
 		return true
 	}
@@ -112,13 +217,28 @@ func (v *Variable) ChangedWithLatestPushValue() bool {
 		if !ok {
 			return true
 		}
-		if v.DiffThreshold != nil {
-			return math.Abs(cache.Value()-latestPush.Value) >= *v.DiffThreshold
+		diffExceeded := func() bool {
+			return cache.reachesThreshold(cache.Value()-latestPush.Value, *v.DiffThreshold)
 		}
-		if v.PctThreshold != nil {
+		pctExceeded := func() bool {
 			percentageChange := lo.Ternary(latestPush.Value == 0, lo.Ternary(cache.Value() == 0, 0, math.MaxFloat64), ((cache.Value()-latestPush.Value)/latestPush.Value)*100)
+			// Epsilon 是数值单位的容差，不用于百分比
 			return math.Abs(percentageChange) >= *v.PctThreshold
 		}
+		if v.DiffThreshold != nil && v.PctThreshold != nil {
+			switch v.ThresholdMode {
+			case ThresholdModeOr:
+				return diffExceeded() || pctExceeded()
+			case ThresholdModeAnd:
+				return diffExceeded() && pctExceeded()
+			}
+		}
+		if v.DiffThreshold != nil {
+			return diffExceeded()
+		}
+		if v.PctThreshold != nil {
+			return pctExceeded()
+		}
 		return cache.Value() != latestPush.Value
 	case *Cache[bool]:
 		latestPush, ok := v.LatestPush.(Point[bool])
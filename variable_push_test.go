@@ -0,0 +1,283 @@
+package edgeexpr
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestVariable_ThresholdMode(t *testing.T) {
+	diff := 5.0
+	pct := 10.0
+
+	// 上次推送值 100，两个阈值都设置：绝对 5，百分比 10%
+	changed := func(mode ThresholdMode, value float64) bool {
+		v := &Variable{Key: "v", DataType: DataTypeFloat32, DiffThreshold: &diff, PctThreshold: &pct, ThresholdMode: mode}
+		v.Cache = v.createCache()
+		past := time.Now().Add(-time.Second)
+		v.WriteValue(100.0, &past)
+		v.LatestPush = v.Cache.(*Cache[float64]).Points[0]
+		v.WriteValue(value, nil)
+		return v.ChangedWithLatestPushValue()
+	}
+
+	cases := []struct {
+		mode     ThresholdMode
+		value    float64
+		expected bool
+	}{
+		// 默认模式：DiffThreshold 优先
+		{ThresholdModeDefault, 106, true},
+		{ThresholdModeDefault, 104, false},
+		// OR：任一阈值超过即发布
+		{ThresholdModeOr, 106, true},
+		{ThresholdModeOr, 104, false},
+		{ThresholdModeOr, 111, true},
+		// AND：两个阈值都超过才发布
+		{ThresholdModeAnd, 106, false},
+		{ThresholdModeAnd, 111, true},
+		{ThresholdModeAnd, 104, false},
+	}
+	for _, c := range cases {
+		if got := changed(c.mode, c.value); got != c.expected {
+			t.Errorf("mode %q value %v: expected %v, got %v", c.mode, c.value, c.expected, got)
+		}
+	}
+}
+
+func TestVariable_ThresholdModeHashAndValidation(t *testing.T) {
+	v := &Variable{Key: "v", DataTypeStr: "Float32"}
+	hash := v.Hash()
+	v.ThresholdMode = ThresholdModeAnd
+	if v.Hash() == hash {
+		t.Error("Expected ThresholdMode to affect the hash")
+	}
+
+	var parsed Variable
+	if err := parsed.UnmarshalJSON([]byte(`{"key":"v","data_type":"Float32","threshold_mode":"xor"}`)); err == nil {
+		t.Error("Expected error for invalid threshold mode")
+	}
+}
+
+func TestNewPushValue(t *testing.T) {
+	ts := time.Now()
+
+	if pv := NewPushValue("temperature", Point[float64]{Value: 21.5, Timestamp: &ts}); pv.Key != "temperature" || pv.Value != 21.5 || pv.Timestamp != &ts {
+		t.Errorf("Unexpected float64 push value: %+v", pv)
+	}
+	if pv := NewPushValue("running", Point[bool]{Value: true, Timestamp: &ts}); pv.Key != "running" || pv.Value != true || pv.Timestamp != &ts {
+		t.Errorf("Unexpected bool push value: %+v", pv)
+	}
+	if pv := NewPushValue("state", Point[string]{Value: "Run", Timestamp: &ts}); pv.Key != "state" || pv.Value != "Run" || pv.Timestamp != &ts {
+		t.Errorf("Unexpected string push value: %+v", pv)
+	}
+	pv := NewPushValue("flags", Point[[]byte]{Value: []byte{0x01, 0x02}, Timestamp: &ts})
+	if b, ok := pv.Value.([]byte); pv.Key != "flags" || !ok || len(b) != 2 || b[1] != 0x02 || pv.Timestamp != &ts {
+		t.Errorf("Unexpected []byte push value: %+v", pv)
+	}
+}
+
+func TestVariable_GetPushValuesSetsKey(t *testing.T) {
+	cycle := time.Second
+	v := &Variable{Key: "running", DataType: DataTypeBool, PublishCycle: &cycle}
+	v.Cache = v.createCache()
+	v.WriteValue(true, nil)
+
+	pushValues := v.GetPushValues(int64(time.Second), 0)
+	if len(pushValues) != 1 {
+		t.Fatalf("Expected 1 push value, got %d", len(pushValues))
+	}
+	if pushValues[0].Key != "running" || pushValues[0].Value != true {
+		t.Errorf("Unexpected push value: %+v", pushValues[0])
+	}
+}
+
+func TestVariable_DisabledProducesNoPushValues(t *testing.T) {
+	cycle := time.Duration(0)
+	enabled := false
+	v := &Variable{Key: "level", DataType: DataTypeFloat32, PublishCycle: &cycle, Enabled: &enabled}
+	v.Cache = v.createCache()
+
+	// 禁用时 WriteValue 不写入
+	v.WriteValue(1.0, nil)
+	if v.Cache.(*Cache[float64]).Len() != 0 {
+		t.Error("Expected WriteValue to be a no-op when disabled")
+	}
+
+	// 即使缓存发生变化也不产生推送值
+	cache := v.Cache.(*Cache[float64])
+	cache.AddPoint(1.0, nil)
+	cache.AddPoint(2.0, nil)
+	if pushValues := v.GetPushValues(int64(time.Second), 0); len(pushValues) != 0 {
+		t.Errorf("Expected no push values when disabled, got %d", len(pushValues))
+	}
+
+	enabled = true
+	if pushValues := v.GetPushValues(int64(time.Second), 0); len(pushValues) != 1 {
+		t.Errorf("Expected 1 push value once enabled, got %d", len(pushValues))
+	}
+}
+
+func TestVariable_ChangeFunc(t *testing.T) {
+	setpoint := 50.0
+	v := &Variable{Key: "level", DataType: DataTypeFloat32}
+	v.Cache = v.createCache()
+	// 只有越过设定值时才视为变化
+	v.ChangeFunc = func(cache any, latestPush any) bool {
+		current := cache.(*Cache[float64]).Value()
+		last, ok := latestPush.(Point[float64])
+		if !ok {
+			return current > setpoint
+		}
+		return (last.Value > setpoint) != (current > setpoint)
+	}
+
+	past := time.Now().Add(-time.Second)
+	v.WriteValue(10.0, &past)
+	if v.ChangedWithLatestPushValue() {
+		t.Error("Expected no change below the setpoint before the first push")
+	}
+	v.LatestPush = v.Cache.(*Cache[float64]).Points[0]
+
+	v.WriteValue(40.0, nil)
+	if v.ChangedWithLatestPushValue() {
+		t.Error("Expected no change while staying below the setpoint")
+	}
+	v.WriteValue(60.0, nil)
+	if !v.ChangedWithLatestPushValue() {
+		t.Error("Expected change when crossing the setpoint")
+	}
+}
+
+func TestVariable_GetPushValuesMetadata(t *testing.T) {
+	cycle := time.Second
+	v := &Variable{Key: "temp", DataType: DataTypeFloat32, Unit: "°C", PublishCycle: &cycle}
+	v.Cache = v.createCache()
+	v.WriteValue(21.5, nil)
+
+	pushValues := v.GetPushValues(int64(time.Second), 0)
+	if len(pushValues) != 1 {
+		t.Fatalf("Expected 1 push value, got %d", len(pushValues))
+	}
+	if pushValues[0].DataType != "Float32" || pushValues[0].Unit != "°C" {
+		t.Errorf("Expected data type Float32 and unit °C, got %q and %q", pushValues[0].DataType, pushValues[0].Unit)
+	}
+
+	// 元数据同样编码到 protobuf
+	data, err := pushValues[0].Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded PushValue
+	if err := decoded.Unmarshal(data); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if decoded.DataType != "Float32" || decoded.Unit != "°C" {
+		t.Errorf("Expected metadata to round-trip, got %+v", decoded)
+	}
+}
+
+func TestVariable_EffectivePublishCycle(t *testing.T) {
+	d := func(v time.Duration) *time.Duration { return &v }
+	tests := []struct {
+		name          string
+		publishCycle  *time.Duration
+		cacheDuration *time.Duration
+		expectedCycle time.Duration
+		publishes     bool
+	}{
+		{"neither set", nil, nil, 0, false},
+		{"only cache duration", nil, d(time.Minute), 0, true},
+		{"only publish cycle", d(5 * time.Second), nil, 5 * time.Second, true},
+		{"both set", d(5 * time.Second), d(time.Minute), 5 * time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &Variable{Key: "level", DataType: DataTypeFloat32, PublishCycle: tt.publishCycle, CacheDuration: tt.cacheDuration}
+			v.Cache = v.createCache()
+
+			cycle, publishes := v.EffectivePublishCycle()
+			if cycle != tt.expectedCycle || publishes != tt.publishes {
+				t.Fatalf("Expected (%v, %v), got (%v, %v)", tt.expectedCycle, tt.publishes, cycle, publishes)
+			}
+
+			v.WriteValue(1.0, nil)
+			first := len(v.GetPushValues(int64(time.Second), 1))
+			// 值未变化时再次推送
+			second := len(v.GetPushValues(int64(time.Second), 2))
+
+			switch {
+			case !tt.publishes:
+				if first != 0 || second != 0 {
+					t.Errorf("Expected no push values, got %d and %d", first, second)
+				}
+			case tt.expectedCycle == 0:
+				// 变化时推送，未变化时不推送
+				if first != 1 || second != 0 {
+					t.Errorf("Expected publish on change only, got %d and %d", first, second)
+				}
+			default:
+				// 5s 周期在第 5 个 tick 推送
+				if first != 0 || second != 0 || len(v.GetPushValues(int64(time.Second), 5)) != 1 {
+					t.Errorf("Expected cyclic publishing every 5 ticks, got %d and %d", first, second)
+				}
+			}
+		})
+	}
+}
+
+func TestVariable_ExportImportState(t *testing.T) {
+	onChange := time.Duration(0)
+	newVariable := func(key string, dataType DataType) *Variable {
+		v := &Variable{Key: key, DataType: dataType, PublishCycle: &onChange}
+		v.Cache = v.createCache()
+		return v
+	}
+	// 模拟重启：导出状态经 JSON 持久化后导入新实例
+	restart := func(old *Variable) *Variable {
+		data, err := json.Marshal(old.ExportState())
+		if err != nil {
+			t.Fatalf("Marshal state failed: %v", err)
+		}
+		var state VariableState
+		if err := json.Unmarshal(data, &state); err != nil {
+			t.Fatalf("Unmarshal state failed: %v", err)
+		}
+		fresh := newVariable(old.Key, old.DataType)
+		if err := fresh.ImportState(state); err != nil {
+			t.Fatalf("ImportState failed: %v", err)
+		}
+		return fresh
+	}
+
+	temp := newVariable("temp", DataTypeFloat32)
+	temp.WriteValue(21.5, nil)
+	if len(temp.GetPushValues(int64(time.Second), 0)) != 1 {
+		t.Fatal("Expected the first value to be published")
+	}
+	restored := restart(temp)
+	restored.WriteValue(21.5, nil)
+	if pushValues := restored.GetPushValues(int64(time.Second), 0); len(pushValues) != 0 {
+		t.Errorf("Expected no republish of an unchanged value after restore, got %d", len(pushValues))
+	}
+	restored.WriteValue(22.0, nil)
+	if pushValues := restored.GetPushValues(int64(time.Second), 0); len(pushValues) == 0 || pushValues[len(pushValues)-1].Value != 22.0 {
+		t.Error("Expected a changed value to publish after restore")
+	}
+
+	blob := newVariable("blob", DataTypeRaw)
+	blob.WriteValue([]byte{0x01, 0xff}, nil)
+	blob.GetPushValues(int64(time.Second), 0)
+	restoredBlob := restart(blob)
+	if p, ok := restoredBlob.LatestPush.(Point[[]byte]); !ok || !bytes.Equal(p.Value, []byte{0x01, 0xff}) || p.Timestamp == nil {
+		t.Errorf("Expected bytes latest push to round-trip, got %#v", restoredBlob.LatestPush)
+	}
+
+	if err := newVariable("other", DataTypeFloat32).ImportState(temp.ExportState()); err == nil {
+		t.Error("Expected error importing state of another variable")
+	}
+	if err := newVariable("temp", DataTypeBool).ImportState(temp.ExportState()); err == nil {
+		t.Error("Expected error importing a float latest push into a bool variable")
+	}
+}
@@ -0,0 +1,843 @@
+package edgeexpr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVariable_HashCoversAllFields(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	d := func(v time.Duration) *time.Duration { return &v }
+
+	base := func() *Variable {
+		return &Variable{
+			Key:           "temperature",
+			Connection:    "plc1",
+			Address:       "DB1.DBD0",
+			DataTypeStr:   "Float32",
+			DiffThreshold: f(0.5),
+			PctThreshold:  f(10),
+			Scale:         f(2),
+			Offset:        f(1),
+			Unit:          "°C",
+			Min:           f(-20),
+			Max:           f(120),
+			PublishCycle:  d(5 * time.Second),
+			CacheDuration: d(time.Minute),
+		}
+	}
+
+	baseHash := base().Hash()
+	if baseHash != base().Hash() {
+		t.Fatal("Expected identical variables to produce the same hash")
+	}
+
+	mutations := map[string]func(v *Variable){
+		"key":            func(v *Variable) { v.Key = "temp2" },
+		"connection":     func(v *Variable) { v.Connection = "plc2" },
+		"address":        func(v *Variable) { v.Address = "DB1.DBD4" },
+		"script":         func(v *Variable) { v.Script = "1 + 1" },
+		"data_type":      func(v *Variable) { v.DataTypeStr = "Float64" },
+		"diff_threshold": func(v *Variable) { v.DiffThreshold = f(0.6) },
+		"pct_threshold":  func(v *Variable) { v.PctThreshold = f(11) },
+		"scale":          func(v *Variable) { v.Scale = f(3) },
+		"offset":         func(v *Variable) { v.Offset = nil },
+		"writable":       func(v *Variable) { v.Writable = true },
+		"unit":           func(v *Variable) { v.Unit = "°F" },
+		"min":            func(v *Variable) { v.Min = f(-40) },
+		"max":            func(v *Variable) { v.Max = nil },
+		"alarms":         func(v *Variable) { v.Alarms = []AlarmDef{{Type: AlarmHi, Limit: 100}} },
+		"transform":      func(v *Variable) { v.Transform = &Transform{Polynomial: []float64{0, 1}} },
+		"enabled":        func(v *Variable) { v.Enabled = new(bool) },
+		"as_tag":         func(v *Variable) { v.AsTag = true },
+		"value_map":      func(v *Variable) { v.ValueMap = map[string]string{"0": "Idle"} },
+		"time_zone":      func(v *Variable) { v.TimeZone = "UTC" },
+		"keep_raw":       func(v *Variable) { v.KeepRaw = true },
+		"group":          func(v *Variable) { v.Group = "boiler" },
+		"publish_cycle":  func(v *Variable) { v.PublishCycle = d(10 * time.Second) },
+		"cache_duration": func(v *Variable) { v.CacheDuration = d(2 * time.Minute) },
+		"min_interval":   func(v *Variable) { v.MinInterval = d(time.Second) },
+	}
+
+	for name, mutate := range mutations {
+		t.Run(name, func(t *testing.T) {
+			v := base()
+			mutate(v)
+			if v.Hash() == baseHash {
+				t.Errorf("Expected hash to change when %s changes", name)
+			}
+		})
+	}
+}
+
+func TestVariable_HashUnserializable(t *testing.T) {
+	nan := math.NaN()
+	// NaN 无法序列化为 JSON，不同变量仍应得到不同的哈希
+	a := &Variable{Key: "a", DataTypeStr: "Float32", Min: &nan}
+	b := &Variable{Key: "b", DataTypeStr: "Float32", Min: &nan}
+	if a.Hash() == b.Hash() {
+		t.Error("Expected unserializable variables with different keys to hash differently")
+	}
+	if a.RuntimeHash() == b.RuntimeHash() {
+		t.Error("Expected unserializable variables with different keys to have different runtime hashes")
+	}
+	// 编码确定：相同配置的独立实例哈希相同
+	nan2 := math.NaN()
+	a2 := &Variable{Key: "a", DataTypeStr: "Float32", Min: &nan2}
+	a2.Cache = NewCache[float64](time.Minute)
+	if a.Hash() != a2.Hash() || a.RuntimeHash() != a2.RuntimeHash() {
+		t.Error("Expected identical unserializable variables to hash the same")
+	}
+	inf := math.Inf(1)
+	if a.Hash() == (&Variable{Key: "a", DataTypeStr: "Float32", Min: &inf}).Hash() {
+		t.Error("Expected NaN and +Inf to hash differently")
+	}
+}
+
+func TestVariable_ReadLastGood(t *testing.T) {
+	v := &Variable{Key: "temperature", DataType: DataTypeFloat32}
+	v.Cache = v.createCache()
+
+	if val, ts, ok := v.ReadLastGood(); ok || val != nil || ts != nil {
+		t.Errorf("Expected no value for empty cache, got %v, %v, %v", val, ts, ok)
+	}
+
+	now := time.Now()
+	good := now.Add(-2 * time.Second)
+	bad := now.Add(-time.Second)
+	v.WriteValue(21.5, &good)
+	v.WriteValue(0, &bad)
+
+	if val, _ := v.Read(); val != 0.0 {
+		t.Fatalf("Expected Read to return the trailing zero, got %v", val)
+	}
+
+	val, ts, ok := v.ReadLastGood()
+	if !ok {
+		t.Fatal("Expected a last good value")
+	}
+	if val != 21.5 {
+		t.Errorf("Expected last good value 21.5, got %v", val)
+	}
+	if ts == nil || !ts.Equal(good) {
+		t.Errorf("Expected timestamp of the good point, got %v", ts)
+	}
+}
+
+func TestVariable_TypedCacheGetters(t *testing.T) {
+	newVar := func(dt DataType) *Variable {
+		v := &Variable{Key: "v", DataType: dt}
+		v.Cache = v.createCache()
+		return v
+	}
+
+	if c, ok := newVar(DataTypeInt16).FloatCache(); !ok || c == nil {
+		t.Error("Expected FloatCache for Int16 variable")
+	}
+	if c, ok := newVar(DataTypeBool).BoolCache(); !ok || c == nil {
+		t.Error("Expected BoolCache for Bool variable")
+	}
+	if c, ok := newVar(DataTypeString).StringCache(); !ok || c == nil {
+		t.Error("Expected StringCache for String variable")
+	}
+	if c, ok := newVar(DataTypeWord).ByteCache(); !ok || c == nil {
+		t.Error("Expected ByteCache for Word variable")
+	}
+
+	// 类型不匹配时返回 false
+	if _, ok := newVar(DataTypeBool).FloatCache(); ok {
+		t.Error("Expected FloatCache to fail for Bool variable")
+	}
+	if _, ok := newVar(DataTypeFloat32).ByteCache(); ok {
+		t.Error("Expected ByteCache to fail for Float32 variable")
+	}
+	mismatched := &Variable{Key: "v", DataType: DataTypeFloat32, Cache: NewCache[bool](time.Minute)}
+	if _, ok := mismatched.FloatCache(); ok {
+		t.Error("Expected FloatCache to fail when the cache does not match the data type")
+	}
+	if _, ok := (&Variable{DataType: DataTypeString}).StringCache(); ok {
+		t.Error("Expected StringCache to fail without a cache")
+	}
+}
+
+func TestVariable_EncodeForWrite(t *testing.T) {
+	v := &Variable{Key: "setpoint", DataType: DataTypeInt16, Writable: true}
+	v.Cache = v.createCache()
+
+	if val, ts := v.LastWritten(); val != nil || ts != nil {
+		t.Errorf("Expected no last write initially, got %v, %v", val, ts)
+	}
+
+	writeTime := time.Now()
+	encoded, err := v.EncodeForWrite(42, &writeTime)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if encoded != int16(42) {
+		t.Errorf("Expected encoded int16(42), got %v (%T)", encoded, encoded)
+	}
+
+	val, ts := v.LastWritten()
+	if val != 42 || ts == nil || !ts.Equal(writeTime) {
+		t.Errorf("Expected last write 42 at %v, got %v at %v", writeTime, val, ts)
+	}
+
+	// 设备读回的值不影响写入记录
+	v.WriteValue(40, nil)
+	if val, _ := v.LastWritten(); val != 42 {
+		t.Errorf("Expected device reads not to change the last write, got %v", val)
+	}
+
+	// 编码失败不更新写入记录
+	if _, err := v.EncodeForWrite("abc", nil); err == nil {
+		t.Error("Expected error for unconvertible value")
+	}
+	if val, _ := v.LastWritten(); val != 42 {
+		t.Errorf("Expected failed write not to be recorded, got %v", val)
+	}
+
+	readOnly := &Variable{Key: "status", DataType: DataTypeBool}
+	if _, err := readOnly.EncodeForWrite(true, nil); err == nil {
+		t.Error("Expected error for non-writable variable")
+	}
+}
+
+func TestVariable_EncodeForWriteScaleOffset(t *testing.T) {
+	scale, offset := 0.1, 10.0
+	v := &Variable{Key: "level", DataType: DataTypeInt16, Writable: true, Scale: &scale, Offset: &offset}
+	v.Cache = v.createCache()
+
+	// 读取：400 * 0.1 + 10 = 50
+	if err := v.WriteValue(int16(400), nil); err != nil {
+		t.Fatalf("WriteValue failed: %v", err)
+	}
+	read, _ := v.Read()
+	if f, _ := read.(float64); math.Abs(f-50) > 1e-9 {
+		t.Fatalf("Expected read 50, got %v", read)
+	}
+
+	// 写入：(50 - 10) / 0.1 = 400，整数输入同样反向换算
+	for _, value := range []any{read, 50, int64(50)} {
+		encoded, err := v.EncodeForWrite(value, nil)
+		if err != nil {
+			t.Fatalf("EncodeForWrite(%v) failed: %v", value, err)
+		}
+		if encoded != int16(400) {
+			t.Errorf("EncodeForWrite(%v %T): expected int16(400), got %v (%T)", value, value, encoded, encoded)
+		}
+		if err := v.WriteValue(encoded, nil); err != nil {
+			t.Fatalf("WriteValue failed: %v", err)
+		}
+		if reread, _ := v.Read(); math.Abs(reread.(float64)-50) > 1e-9 {
+			t.Errorf("Expected round trip to read 50, got %v", reread)
+		}
+	}
+}
+
+func TestVariable_JSONExcludesRuntimeFields(t *testing.T) {
+	v := &Variable{Key: "temperature", Connection: "plc1", Address: "DB1.DBD0", DataTypeStr: "Float32", Writable: true}
+	v.DataType, v.Bytes, _ = ParseDataType(v.DataTypeStr)
+	v.Cache = v.createCache()
+	v.WriteValue(21.5, nil)
+	v.LatestPush = v.Cache.(*Cache[float64]).Points[0]
+	v.EncodeForWrite(22.0, nil)
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Failed to marshal variable: %v", err)
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("Failed to unmarshal variable JSON: %v", err)
+	}
+	for _, runtimeField := range []string{"DataType", "Bytes", "Cache", "Program", "LatestPush", "LastWrite"} {
+		if _, ok := fields[runtimeField]; ok {
+			t.Errorf("Expected runtime field %s to be excluded from JSON: %s", runtimeField, data)
+		}
+	}
+
+	// 反序列化重建运行时字段
+	var parsed Variable
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+	if parsed.DataType != DataTypeFloat32 || parsed.Bytes != 4 {
+		t.Errorf("Expected DataType Float32 with 4 bytes, got %s with %d", parsed.DataType, parsed.Bytes)
+	}
+	if _, ok := parsed.FloatCache(); !ok {
+		t.Error("Expected float cache to be recreated")
+	}
+}
+
+func TestVariable_ValueMap(t *testing.T) {
+	jsonStr := `{
+		"key": "state",
+		"connection": "plc1",
+		"address": "DB1.DBW0",
+		"data_type": "String",
+		"value_map": {"0": "Idle", "1": "Run", "2": "Fault"}
+	}`
+
+	var v Variable
+	if err := json.Unmarshal([]byte(jsonStr), &v); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+
+	// 数值和字符串形式的设备码都应映射为标签
+	for _, raw := range []any{"2", 2} {
+		if err := v.WriteValue(raw, nil); err != nil {
+			t.Fatalf("WriteValue(%v) failed: %v", raw, err)
+		}
+		if val, _ := v.Read(); val != "Fault" {
+			t.Errorf("Expected %v to map to Fault, got %v", raw, val)
+		}
+	}
+
+	// 未映射的值保留原始字符串
+	if err := v.WriteValue("7", nil); err != nil {
+		t.Fatalf("WriteValue failed: %v", err)
+	}
+	if val, _ := v.Read(); val != "7" {
+		t.Errorf("Expected unmapped value 7, got %v", val)
+	}
+
+	data, err := json.Marshal(&v)
+	if err != nil {
+		t.Fatalf("Failed to marshal variable: %v", err)
+	}
+	var restored Variable
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+	if restored.ValueMap["2"] != "Fault" {
+		t.Errorf("Expected value_map to round-trip, got %v", restored.ValueMap)
+	}
+}
+
+func TestVariable_MinInterval(t *testing.T) {
+	jsonStr := `{
+		"key": "flow",
+		"connection": "plc1",
+		"address": "DB1.DBD0",
+		"data_type": "Float32",
+		"min_interval": "1s"
+	}`
+
+	var v Variable
+	if err := json.Unmarshal([]byte(jsonStr), &v); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+	if v.MinInterval == nil || *v.MinInterval != time.Second {
+		t.Fatalf("Expected MinInterval 1s, got %v", v.MinInterval)
+	}
+
+	first := time.Now()
+	second := first.Add(10 * time.Millisecond)
+	if err := v.WriteValue(1.0, &first); err != nil {
+		t.Fatalf("WriteValue failed: %v", err)
+	}
+	if err := v.WriteValue(2.0, &second); err != nil {
+		t.Fatalf("WriteValue failed: %v", err)
+	}
+
+	cache, _ := v.FloatCache()
+	if cache.Len() != 1 {
+		t.Errorf("Expected 1 stored point, got %d", cache.Len())
+	}
+	if val, _ := v.Read(); val != 1.0 {
+		t.Errorf("Expected first value to be kept, got %v", val)
+	}
+
+	// 超过最小间隔后可以写入
+	third := first.Add(time.Second)
+	if err := v.WriteValue(3.0, &third); err != nil {
+		t.Fatalf("WriteValue failed: %v", err)
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Expected 2 stored points, got %d", cache.Len())
+	}
+
+	// 同一时间戳的修正和补录的旧数据不受最小间隔限制
+	if err := v.WriteValue(3.5, &third); err != nil {
+		t.Fatalf("WriteValue failed: %v", err)
+	}
+	if val, _ := v.Read(); val != 3.5 {
+		t.Errorf("Expected correction at the same timestamp to apply, got %v", val)
+	}
+	backfill := first.Add(500 * time.Millisecond)
+	if err := v.WriteValue(1.5, &backfill); err != nil {
+		t.Fatalf("WriteValue failed: %v", err)
+	}
+	if cache.Len() != 3 {
+		t.Errorf("Expected backfilled point to be stored, got %d points", cache.Len())
+	}
+}
+
+func TestVariable_TimeFunc(t *testing.T) {
+	var v Variable
+	if err := json.Unmarshal([]byte(`{"key": "temp", "connection": "plc1", "address": "DB1.DBD0", "data_type": "Float32"}`), &v); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+
+	// 使用缓存窗口内的固定时间，避免被过期清理
+	fixed := time.Now().Add(-10 * time.Second).Truncate(time.Second)
+	v.TimeFunc = func() time.Time { return fixed }
+
+	if err := v.WriteValue(12.5, nil); err != nil {
+		t.Fatalf("WriteValue failed: %v", err)
+	}
+	_, ts := v.Read()
+	if ts == nil || !ts.Equal(fixed) {
+		t.Errorf("Expected timestamp %v, got %v", fixed, ts)
+	}
+
+	// 显式传入的时间戳优先
+	explicit := fixed.Add(time.Second)
+	if err := v.WriteValue(13.5, &explicit); err != nil {
+		t.Fatalf("WriteValue failed: %v", err)
+	}
+	if _, ts := v.Read(); ts == nil || !ts.Equal(explicit) {
+		t.Errorf("Expected timestamp %v, got %v", explicit, ts)
+	}
+}
+
+func TestVariable_WriteValueScaleOverflow(t *testing.T) {
+	defer func() { ScaleOverflow = OverflowError }()
+
+	var v Variable
+	if err := json.Unmarshal([]byte(`{"key": "speed", "connection": "plc1", "address": "DB1.DBW0", "data_type": "Int16", "scale": 10, "offset": -100}`), &v); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+
+	// 原始值 40000 超出 Int16 范围
+	ScaleOverflow = OverflowError
+	if err := v.WriteValue(40000, nil); err == nil {
+		t.Error("Expected error for raw value beyond Int16 range")
+	}
+	if _, ts := v.Read(); ts != nil {
+		t.Error("Expected nothing stored")
+	}
+
+	// 原始值在范围内时，换算后超出 Int16 范围的工程值是有效读数
+	if err := v.WriteValue(5000, nil); err != nil {
+		t.Errorf("Unexpected error for in-range raw value: %v", err)
+	}
+	if val, _ := v.Read(); val != 49900.0 {
+		t.Errorf("Expected 49900, got %v", val)
+	}
+
+	ScaleOverflow = OverflowClamp
+	var clamped []float64
+	OnOverflowClamp = func(value float64, dataType DataType) { clamped = append(clamped, value) }
+	defer func() { OnOverflowClamp = nil }()
+	if err := v.WriteValue(-40000, nil); err != nil {
+		t.Fatalf("Unexpected error under clamp policy: %v", err)
+	}
+	if val, _ := v.Read(); val != float64(math.MinInt16)*10-100 {
+		t.Errorf("Expected clamped value %d scaled, got %v", math.MinInt16, val)
+	}
+	if len(clamped) != 1 || clamped[0] != -40000 {
+		t.Errorf("Expected one clamp report for -40000, got %v", clamped)
+	}
+}
+
+func TestVariable_ExportCSV(t *testing.T) {
+	var v Variable
+	if err := json.Unmarshal([]byte(`{"key": "temp", "connection": "plc1", "address": "DB1.DBD0", "data_type": "Float32"}`), &v); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+	ts := time.Now().UTC().Truncate(time.Second)
+	v.WriteValue(21.5, &ts)
+
+	var buf bytes.Buffer
+	if err := v.ExportCSV(&buf); err != nil {
+		t.Fatalf("ExportCSV failed: %v", err)
+	}
+	expected := "key,timestamp,value\ntemp," + ts.Format(time.RFC3339Nano) + ",21.5\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestVariable_ReadTyped(t *testing.T) {
+	tests := []struct {
+		dataType string
+		write    any
+		expected any
+	}{
+		{"Int16", -1234, int16(-1234)},
+		{"UInt8", 200, uint8(200)},
+		{"Float32", 21.5, float32(21.5)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dataType, func(t *testing.T) {
+			var v Variable
+			if err := json.Unmarshal([]byte(`{"key": "v", "connection": "plc1", "address": "DB1.DBD0", "data_type": "`+tt.dataType+`"}`), &v); err != nil {
+				t.Fatalf("Failed to unmarshal variable: %v", err)
+			}
+			if _, ok, _ := v.ReadTyped(); ok {
+				t.Error("Expected ok=false before any write")
+			}
+			if err := v.WriteValue(tt.write, nil); err != nil {
+				t.Fatalf("WriteValue failed: %v", err)
+			}
+			val, ok, ts := v.ReadTyped()
+			if !ok || ts == nil {
+				t.Fatalf("Expected a typed value, got ok=%v ts=%v", ok, ts)
+			}
+			if val != tt.expected {
+				t.Errorf("Expected %v (%T), got %v (%T)", tt.expected, tt.expected, val, val)
+			}
+		})
+	}
+}
+
+func TestVariable_WriteBit(t *testing.T) {
+	var v Variable
+	if err := json.Unmarshal([]byte(`{"key": "control", "connection": "plc1", "address": "DB1.DBW0", "data_type": "Word"}`), &v); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+	if err := v.WriteValue([]byte{0x01, 0x00}, nil); err != nil {
+		t.Fatalf("WriteValue failed: %v", err)
+	}
+
+	// 设置第二个字节的 bit 1
+	if err := v.WriteBit(9, true, nil); err != nil {
+		t.Fatalf("WriteBit failed: %v", err)
+	}
+	if val, _ := v.Read(); !bytes.Equal(val.([]byte), []byte{0x01, 0x02}) {
+		t.Errorf("Expected [1 2], got %v", val)
+	}
+
+	if err := v.WriteBit(0, false, nil); err != nil {
+		t.Fatalf("WriteBit failed: %v", err)
+	}
+	if val, _ := v.Read(); !bytes.Equal(val.([]byte), []byte{0x00, 0x02}) {
+		t.Errorf("Expected [0 2], got %v", val)
+	}
+
+	if err := v.WriteBit(16, true, nil); err == nil {
+		t.Error("Expected error for bit index beyond the word")
+	}
+
+	var f Variable
+	if err := json.Unmarshal([]byte(`{"key": "temp", "connection": "plc1", "address": "DB1.DBD0", "data_type": "Float32"}`), &f); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+	if err := f.WriteBit(0, true, nil); err == nil {
+		t.Error("Expected error for non-byte variable")
+	}
+}
+
+func TestVariable_ByteLayout(t *testing.T) {
+	tests := []struct {
+		dataType string
+		expected int
+		wantErr  bool
+	}{
+		{"String[20]", 22, false}, // 含 2 字节 Siemens 头
+		{"DWord", 4, false},
+		{"String", 0, true},
+	}
+	for _, tt := range tests {
+		var v Variable
+		if err := json.Unmarshal([]byte(`{"key": "v", "connection": "plc1", "address": "DB1.DBB0", "data_type": "`+tt.dataType+`"}`), &v); err != nil {
+			t.Fatalf("Failed to unmarshal variable: %v", err)
+		}
+		size, err := v.ByteLayout()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error %v, got %v", tt.dataType, tt.wantErr, err)
+		}
+		if size != tt.expected {
+			t.Errorf("%s: expected size %d, got %d", tt.dataType, tt.expected, size)
+		}
+	}
+
+	// 构造后被修改的字段应被检测出来
+	var v Variable
+	if err := json.Unmarshal([]byte(`{"key": "v", "connection": "plc1", "address": "DB1.DBD0", "data_type": "DWord"}`), &v); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+	v.Bytes = 2
+	if _, err := v.ByteLayout(); err == nil {
+		t.Error("Expected error when Bytes disagrees with data_type")
+	}
+}
+
+func TestVariable_ReadChanged(t *testing.T) {
+	var v Variable
+	if err := json.Unmarshal([]byte(`{"key": "temp", "connection": "plc1", "address": "DB1.DBD0", "data_type": "Float32"}`), &v); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+	if _, changed, ts := v.ReadChanged(); changed || ts != nil {
+		t.Error("Expected no change before any write")
+	}
+
+	v.WriteValue(1.0, nil)
+	if _, changed, _ := v.ReadChanged(); !changed {
+		t.Error("Expected first read to report changed")
+	}
+
+	// 两次读取之间值变化后又恢复，最新两点不同，但相对上次读取未变化
+	v.WriteValue(2.0, nil)
+	v.WriteValue(3.0, nil)
+	v.WriteValue(1.0, nil)
+	if !v.PointsChanged() {
+		t.Error("Expected PointsChanged to compare the latest two points")
+	}
+	if _, changed, _ := v.ReadChanged(); changed {
+		t.Error("Expected no change since the last read")
+	}
+
+	// 两次读取之间写入多个相同值，最新两点相同，但相对上次读取已变化
+	v.WriteValue(5.0, nil)
+	v.WriteValue(5.0, nil)
+	if v.PointsChanged() {
+		t.Error("Expected PointsChanged to report the latest two points equal")
+	}
+	if val, changed, _ := v.ReadChanged(); !changed || val != 5.0 {
+		t.Errorf("Expected changed value 5, got %v (changed %v)", val, changed)
+	}
+	if _, changed, _ := v.ReadChanged(); changed {
+		t.Error("Expected no change on repeated read")
+	}
+}
+
+func TestVariable_WriteValues(t *testing.T) {
+	var v Variable
+	if err := json.Unmarshal([]byte(`{"key": "temp", "connection": "plc1", "address": "DB1.DBD0", "data_type": "Float32"}`), &v); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+	// 已有一个较新的点
+	now := time.Now()
+	v.WriteValue(100.0, &now)
+
+	// 乱序回填十个历史点
+	base := now.Add(-30 * time.Second)
+	values := make([]PushValue, 0, 10)
+	for i := 9; i >= 0; i-- {
+		ts := base.Add(time.Duration(i) * time.Second)
+		values = append(values, PushValue{Key: "temp", Value: float64(i), Timestamp: &ts})
+	}
+	if err := v.WriteValues(values); err != nil {
+		t.Fatalf("WriteValues failed: %v", err)
+	}
+
+	cache, _ := v.FloatCache()
+	if cache.Len() != 11 {
+		t.Fatalf("Expected 11 points, got %d", cache.Len())
+	}
+	for i := 0; i < 10; i++ {
+		p, _ := cache.AtIndex(i)
+		if p.Value != float64(i) {
+			t.Errorf("Expected value %d at index %d, got %v", i, i, p.Value)
+		}
+	}
+	if cache.Value() != 100.0 {
+		t.Errorf("Expected latest value 100, got %v", cache.Value())
+	}
+
+	// 任一值转换失败时不写入
+	bad := []PushValue{{Key: "temp", Value: 1.0}, {Key: "temp", Value: "abc"}}
+	if err := v.WriteValues(bad); err == nil {
+		t.Error("Expected error for unconvertible value")
+	}
+	if cache.Len() != 11 {
+		t.Errorf("Expected nothing written, got %d points", cache.Len())
+	}
+}
+
+func TestVariable_Matches(t *testing.T) {
+	var v Variable
+	if err := json.Unmarshal([]byte(`{"key": "temp", "connection": "plc1", "address": "DB1.DBD0", "data_type": "Float32"}`), &v); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+	if _, err := v.Matches("value > 10"); err == nil {
+		t.Error("Expected error before any write")
+	}
+
+	v.WriteValue(12.0, nil)
+	if ok, err := v.Matches("value > 10"); err != nil || !ok {
+		t.Errorf("Expected 12 > 10 to match, got %v (err: %v)", ok, err)
+	}
+	v.WriteValue(8.0, nil)
+	if ok, err := v.Matches("value > 10"); err != nil || ok {
+		t.Errorf("Expected 8 > 10 not to match, got %v (err: %v)", ok, err)
+	}
+	if len(v.predicates) != 1 {
+		t.Errorf("Expected 1 cached predicate, got %d", len(v.predicates))
+	}
+
+	// 类型不匹配的谓词在编译时报错
+	_, err := v.Matches(`value startsWith "a"`)
+	if !errors.Is(err, ErrScriptCompile) {
+		t.Errorf("Expected ErrScriptCompile for type-mismatched predicate, got %v", err)
+	}
+}
+
+func TestVariable_TimeZone(t *testing.T) {
+	var v Variable
+	if err := json.Unmarshal([]byte(`{"key": "temp", "connection": "plc1", "address": "DB1.DBD0", "data_type": "Float32", "time_zone": "Asia/Shanghai"}`), &v); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+
+	ts := time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC)
+	formatted, err := v.FormatTimestamp(ts)
+	if err != nil {
+		t.Fatalf("FormatTimestamp failed: %v", err)
+	}
+	if formatted != "2024-03-01T16:30:00+08:00" {
+		t.Errorf("Expected 2024-03-01T16:30:00+08:00, got %s", formatted)
+	}
+
+	// 导出时使用配置的时区
+	recent := time.Now().UTC().Truncate(time.Second)
+	v.WriteValue(21.5, &recent)
+	var buf bytes.Buffer
+	if err := v.ExportCSV(&buf); err != nil {
+		t.Fatalf("ExportCSV failed: %v", err)
+	}
+	loc, _ := time.LoadLocation("Asia/Shanghai")
+	expected := "temp," + recent.In(loc).Format(time.RFC3339Nano) + ",21.5"
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("Expected row %q, got %q", expected, buf.String())
+	}
+
+	if data, _ := json.Marshal(&v); !strings.Contains(string(data), `"time_zone":"Asia/Shanghai"`) {
+		t.Errorf("Expected time_zone in JSON, got %s", data)
+	}
+
+	var invalid Variable
+	if err := json.Unmarshal([]byte(`{"key": "temp", "connection": "plc1", "address": "DB1.DBD0", "data_type": "Float32", "time_zone": "Mars/Olympus"}`), &invalid); err == nil {
+		t.Error("Expected error for unknown time zone")
+	}
+}
+
+func TestVariable_ChangedAccumulatesDrift(t *testing.T) {
+	var v Variable
+	if err := json.Unmarshal([]byte(`{"key": "temp", "connection": "plc1", "address": "DB1.DBD0", "data_type": "Float32", "diff_threshold": 1.0, "publish_cycle": "0s"}`), &v); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+
+	base := time.Now().Add(-10 * time.Second)
+	write := func(i int, value float64) {
+		ts := base.Add(time.Duration(i) * time.Second)
+		v.WriteValue(value, &ts)
+	}
+	write(0, 20.0)
+	if len(v.GetPushValues(int64(time.Second), 0)) != 1 {
+		t.Fatal("Expected the first value to be published")
+	}
+
+	// 每次变化 0.4，均低于阈值，但累计漂移最终超过阈值
+	write(1, 20.4)
+	if v.Changed() {
+		t.Error("Expected 0.4 drift not to count as changed")
+	}
+	write(2, 20.8)
+	if v.Changed() {
+		t.Error("Expected 0.8 drift not to count as changed")
+	}
+	write(3, 21.2)
+	if !v.Changed() {
+		t.Error("Expected cumulative 1.2 drift to count as changed")
+	}
+	cache, _ := v.FloatCache()
+	if exceeds, _ := cache.DiffExceeds(1.0); exceeds {
+		t.Error("Expected the last two points alone to stay below the threshold")
+	}
+}
+
+func TestVariable_ChangedAgreesWithDiffExceeds(t *testing.T) {
+	var v Variable
+	if err := json.Unmarshal([]byte(`{"key": "temp", "connection": "plc1", "address": "DB1.DBD0", "data_type": "Float32", "diff_threshold": 1.0, "publish_cycle": "0s"}`), &v); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+	first := time.Now().Add(-2 * time.Second)
+	v.WriteValue(20.0, &first)
+	v.GetPushValues(int64(time.Second), 0)
+
+	second := time.Now().Add(-time.Second)
+	v.WriteValue(21.0, &second)
+	cache, _ := v.FloatCache()
+	exceeds, _ := cache.DiffExceeds(1.0)
+	if !v.Changed() || !exceeds {
+		t.Errorf("Expected push and read change detection to agree at the threshold, got Changed=%v DiffExceeds=%v", v.Changed(), exceeds)
+	}
+}
+
+func TestVariable_RawPassthrough(t *testing.T) {
+	var v Variable
+	if err := json.Unmarshal([]byte(`{"key": "blob", "connection": "plc1", "address": "DB1.DBB0", "data_type": "Raw"}`), &v); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+	if v.DataType != DataTypeRaw || v.Bytes != 0 {
+		t.Fatalf("Expected Raw with 0 bytes, got %s with %d", v.DataType, v.Bytes)
+	}
+	if _, ok := v.ByteCache(); !ok {
+		t.Fatal("Expected Cache[[]byte] for Raw")
+	}
+
+	blob := []byte{0x00, 0xff, 0x10, 0x7f, 0x80, 0x01, 0x02, 0x03, 0x04}
+	if err := v.WriteValue(blob, nil); err != nil {
+		t.Fatalf("WriteValue failed: %v", err)
+	}
+	// 修改调用方的切片不影响缓存中的值
+	blob[0] = 0xaa
+	val, _ := v.Read()
+	expected := []byte{0x00, 0xff, 0x10, 0x7f, 0x80, 0x01, 0x02, 0x03, 0x04}
+	if !bytes.Equal(val.([]byte), expected) {
+		t.Errorf("Expected %v, got %v", expected, val)
+	}
+
+	if err := v.WriteValue(3.5, nil); err == nil {
+		t.Error("Expected error for non-byte value")
+	}
+}
+
+func TestVariable_KeepRaw(t *testing.T) {
+	var v Variable
+	if err := json.Unmarshal([]byte(`{"key": "pressure", "connection": "plc1", "address": "DB1.DBW0", "data_type": "Int16", "scale": 0.1, "offset": -5, "keep_raw": true}`), &v); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+	if err := v.WriteValue(250, nil); err != nil {
+		t.Fatalf("WriteValue failed: %v", err)
+	}
+
+	scaled, _ := v.Read()
+	raw, ts := v.ReadRaw()
+	if ts == nil || raw != 250.0 {
+		t.Errorf("Expected raw value 250, got %v", raw)
+	}
+	if math.Abs(scaled.(float64)-20) > 1e-9 {
+		t.Errorf("Expected scaled value 20, got %v", scaled)
+	}
+
+	// 默认不保留原始值
+	var plain Variable
+	if err := json.Unmarshal([]byte(`{"key": "pressure", "connection": "plc1", "address": "DB1.DBW0", "data_type": "Int16", "scale": 0.1}`), &plain); err != nil {
+		t.Fatalf("Failed to unmarshal variable: %v", err)
+	}
+	plain.WriteValue(250, nil)
+	if plain.RawCache != nil {
+		t.Error("Expected no RawCache without keep_raw")
+	}
+	if raw, _ := plain.ReadRaw(); raw != nil {
+		t.Errorf("Expected nil raw value, got %v", raw)
+	}
+
+	// 批量回填同样写入原始值
+	backfill := time.Now().Add(-10 * time.Second)
+	if err := v.WriteValues([]PushValue{{Value: 100, Timestamp: &backfill}}); err != nil {
+		t.Fatalf("WriteValues failed: %v", err)
+	}
+	if v.RawCache.Len() != 2 {
+		t.Errorf("Expected 2 raw points after backfill, got %d", v.RawCache.Len())
+	}
+}
@@ -6,12 +6,18 @@ package main
 import (
 	_ "crypto/sha512"
 	"syscall/js"
+
+	edgeexpr "github.com/thinkontrol/edge-expr"
 )
 
 func main() {
 
 	done := make(chan struct{})
 	js.Global().Set("wasmValidScript", js.FuncOf(wasmValidScript))
+	js.Global().Set("wasmSuggest", js.FuncOf(wasmSuggest))
+	js.Global().Set("wasmCacheMethods", js.FuncOf(wasmCacheMethods))
+	js.Global().Set("wasmDataTypeCatalog", js.FuncOf(wasmDataTypeCatalog))
+	js.Global().Set("wasmAvailableFunctions", js.FuncOf(wasmAvailableFunctions))
 	<-done
 }
 
@@ -35,3 +41,28 @@ func wasmValidScript(_ js.Value, args []js.Value) interface{} {
 	}
 	return marshalJSON(result)
 }
+
+func wasmSuggest(_ js.Value, args []js.Value) interface{} {
+
+	var plcVars map[string]string
+	if err := unmarshalJSON(args[0], &plcVars); err != nil {
+		return err.Error()
+	}
+	suggestions, err := Suggest(plcVars, args[1].String())
+	if err != nil {
+		return err.Error()
+	}
+	return marshalJSON(suggestions)
+}
+
+func wasmCacheMethods(_ js.Value, _ []js.Value) interface{} {
+	return marshalJSON(edgeexpr.CacheMethods())
+}
+
+func wasmDataTypeCatalog(_ js.Value, _ []js.Value) interface{} {
+	return marshalJSON(edgeexpr.DataTypeCatalog())
+}
+
+func wasmAvailableFunctions(_ js.Value, _ []js.Value) interface{} {
+	return marshalJSON(edgeexpr.AvailableFunctions())
+}
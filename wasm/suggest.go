@@ -0,0 +1,63 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"sort"
+	"strings"
+
+	edgeexpr "github.com/thinkontrol/edge-expr"
+)
+
+// Suggest returns the sorted identifiers (variable paths and cache method calls) matching prefix
+func Suggest(plcVar map[string]string, prefix string) ([]string, error) {
+	env, err := buildEnv(plcVar)
+	if err != nil {
+		return nil, err
+	}
+
+	var identifiers []string
+	collectIdentifiers(env, "", &identifiers)
+
+	result := make([]string, 0)
+	for _, id := range identifiers {
+		if strings.HasPrefix(id, prefix) {
+			result = append(result, id)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// collectIdentifiers walks the nested env and appends every dotted path, plus the cache method
+// names for each leaf holding a cache. buildEnv fills leaves with raw values, on which the methods
+// would not compile, so those leaves only suggest their path.
+func collectIdentifiers(env map[string]any, parent string, identifiers *[]string) {
+	for key, value := range env {
+		path := key
+		if parent != "" {
+			path = parent + "." + key
+		}
+		*identifiers = append(*identifiers, path)
+		if next, ok := value.(map[string]any); ok {
+			collectIdentifiers(next, path, identifiers)
+			continue
+		}
+		if !isCache(value) {
+			continue
+		}
+		for _, method := range edgeexpr.CacheMethods() {
+			*identifiers = append(*identifiers, path+"."+method.Name)
+		}
+	}
+}
+
+func isCache(value any) bool {
+	switch value.(type) {
+	case *edgeexpr.Cache[float64], *edgeexpr.Cache[bool], *edgeexpr.Cache[string], *edgeexpr.Cache[[]byte]:
+		return true
+	default:
+		return false
+	}
+}
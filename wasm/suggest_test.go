@@ -0,0 +1,65 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	edgeexpr "github.com/thinkontrol/edge-expr"
+)
+
+func TestSuggest(t *testing.T) {
+	plcVars := map[string]string{
+		"line1.temperature": "Float32",
+		"line1.running":     "Bool",
+		"pressure":          "Int16",
+	}
+
+	suggestions, err := Suggest(plcVars, "line1.")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(suggestions) < 2 || suggestions[0] != "line1.running" {
+		t.Fatalf("Expected sorted suggestions starting with line1.running, got %v", suggestions)
+	}
+	for _, s := range suggestions {
+		if s == "pressure" {
+			t.Errorf("Unexpected suggestion outside prefix: %s", s)
+		}
+	}
+	// buildEnv 的叶子是原始值，方法调用无法通过 ValidScript，不作建议
+	if containsString(suggestions, "line1.temperature.MA") {
+		t.Errorf("Unexpected cache method suggestion for a raw value, got %v", suggestions)
+	}
+
+	var identifiers []string
+	collectIdentifiers(map[string]any{"temperature": edgeexpr.NewCache[float64](time.Minute)}, "", &identifiers)
+	if !containsString(identifiers, "temperature.MA") {
+		t.Errorf("Expected cache method suggestion temperature.MA for a cache, got %v", identifiers)
+	}
+
+	suggestions, err = Suggest(plcVars, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, expected := range []string{"line1", "line1.temperature", "pressure"} {
+		if !containsString(suggestions, expected) {
+			t.Errorf("Expected suggestion %s, got %v", expected, suggestions)
+		}
+	}
+
+	if _, err := Suggest(map[string]string{"bad": "Unknown"}, ""); err == nil {
+		t.Error("Expected error for unknown data type")
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -9,28 +9,30 @@ import (
 	"strconv"
 	"strings"
 	"syscall/js"
+	"time"
 
 	"github.com/expr-lang/expr"
 	edgeexpr "github.com/thinkontrol/edge-expr"
 )
 
-func ValidScript(plcVar map[string]string, script string) (string, error) {
+// buildEnv builds a nested expr environment from dotted plc var keys, filled with random values
+func buildEnv(plcVar map[string]string) (map[string]any, error) {
 	env := make(map[string]any)
 	for key, dtStr := range plcVar {
 		parts := strings.Split(key, ".")
 		if len(parts) == 0 {
-			return "", fmt.Errorf("invalid plc var key: %s", key)
+			return nil, fmt.Errorf("invalid plc var key: %s", key)
 		}
 		cur := env
 		for i, k := range parts {
 			if i == len(parts)-1 {
 				dt, _, err := edgeexpr.ParseDataType(dtStr)
 				if err != nil {
-					return "", err
+					return nil, err
 				}
 				rv, err := dt.GenerateRandomValue()
 				if err != nil {
-					return "", err
+					return nil, err
 				}
 				cur[k] = rv
 			} else {
@@ -45,11 +47,19 @@ func ValidScript(plcVar map[string]string, script string) (string, error) {
 		}
 
 	}
+	return env, nil
+}
+
+func ValidScript(plcVar map[string]string, script string) (string, error) {
+	env, err := buildEnv(plcVar)
+	if err != nil {
+		return "", err
+	}
 
 	js.Global().Get("console").Call("log", marshalJSON(env))
 	js.Global().Get("console").Call("log", script)
 
-	program, err := expr.Compile(script, expr.Env(env))
+	program, err := expr.Compile(script, edgeexpr.ScriptOptions(env)...)
 	if err != nil {
 		return "", err
 	}
@@ -97,6 +107,12 @@ func InferTypeName(value any) string {
 		return "float"
 	case string:
 		return "string"
+	case []byte:
+		return "bytes"
+	case time.Time:
+		return "time"
+	case time.Duration:
+		return "duration"
 	default:
 		return ""
 	}
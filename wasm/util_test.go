@@ -0,0 +1,35 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInferTypeName(t *testing.T) {
+	tests := map[string]struct {
+		value    any
+		expected string
+	}{
+		"bytes":    {[]byte{0x01, 0x02}, "bytes"},
+		"time":     {time.Now(), "time"},
+		"duration": {5 * time.Second, "duration"},
+		"int":      {int64(1), "int"},
+		"uint8":    {uint8(1), "int"},
+		"float":    {1.5, "float"},
+		"bool":     {true, "bool"},
+		"string":   {"a", "string"},
+		"nil":      {nil, ""},
+		"slice":    {[]int{1}, ""},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := InferTypeName(tt.value); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}